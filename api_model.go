@@ -2,12 +2,11 @@ package main
 
 import (
 	"fmt"
-	"net/http"
 )
 
 type SlyftApiModelInterface interface {
-	EndPoint() string
 	getName() string
+	remove() error
 }
 
 func DeleteApiModel(inst SlyftApiModelInterface) {
@@ -16,10 +15,9 @@ func DeleteApiModel(inst SlyftApiModelInterface) {
 	}
 	confirm := askForConfirmation("Are you sure to delete element '" + inst.getName() + "'?")
 	if confirm {
-		resp, err := Do(inst.EndPoint(), "DELETE", nil)
-		defer resp.Body.Close()
-		if err != nil || resp.StatusCode != http.StatusNoContent {
-			fmt.Printf("Something went wrong. Please try again. (ResponseCode: %d)\n", resp.StatusCode)
+		err := inst.remove()
+		if err != nil {
+			fmt.Printf("Something went wrong. Please try again. (%s)\n", err)
 			Log.Debug(err)
 		} else {
 			fmt.Println("Was successfully deleted")
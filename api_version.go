@@ -2,33 +2,157 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	version "github.com/mcuadros/go-version"
+	"github.com/thingforward/slyft-cli/slyft"
 )
 
 const CONFIG_JSON_URL = "https://s3-eu-west-1.amazonaws.com/io-slyft-config/slyft-config.json"
 
+// the config JSON is fetched from here, tests point it elsewhere
+var configJsonURL = CONFIG_JSON_URL
+
+// The config JSON is cached for updateCheckTTL. A stale cache is refreshed
+// in the background, giving up after updateCheckTimeout; after a failure,
+// the next attempt is made after updateCheckRetry.
+const (
+	updateCheckTTL     = 24 * time.Hour
+	updateCheckRetry   = time.Hour
+	updateCheckTimeout = 2 * time.Second
+)
+
+// --no-update-check, see main()
+var fNoUpdateCheck *bool
+
 type configJson struct {
 	APIVersion struct {
 		Min     int `json:"min"`
 		Max     int `json:"max"`
 		Current int `json:"current"`
 	} `json:"api_version"`
-	EndPoints []struct {
-		Num1 string `json:"1,omitempty"`
-		Num2 string `json:"2,omitempty"`
-		Num3 string `json:"3,omitempty"`
-		Num4 string `json:"4,omitempty"`
-	} `json:"end_points"`
+	// backend URLs by API version, e.g. [{"1": "https://..."}]
+	EndPoints     []map[string]string `json:"end_points"`
 	ClientVersion struct {
 		Latest string   `json:"latest"`
 		Update []string `json:"update"`
 	} `json:"client_version"`
+	// the config JSON must not be used after this time, which is mandatory
+	// so that an old signed config JSON cannot be replayed forever
+	Expires time.Time `json:"expires"`
+}
+
+func (c *configJson) expired() bool {
+	return c.Expires.IsZero() || time.Now().After(c.Expires)
+}
+
+// endpoint returns the backend URL for API version v, or "" if config
+// lists none.
+func (c *configJson) endpoint(v int) string {
+	for _, ep := range c.EndPoints {
+		if url := ep[strconv.Itoa(v)]; url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
+// API version and backend chosen by negotiateAPI
+var (
+	apiVersion  = slyft.MaxAPIVersion
+	apiEndpoint string
+)
+
+// negotiateAPI picks the API version and backend. Without a backend
+// configured explicitly, they are taken from the cached config JSON. Else,
+// or if that has expired, the backend is asked for the API versions it
+// supports, see backendAPIVersions; if it does not tell, the defaults are
+// kept. It returns a *slyft.VersionMismatchError if this client supports
+// none of the API versions of the backend.
+func negotiateAPI() error {
+	if replaying() {
+		return nil
+	}
+	if currentSettings().Backend == "" {
+		if cache := readConfigCache(); cache.usable() && cache.Config.APIVersion.Max != 0 {
+			v := cache.Config.APIVersion
+			negotiated, err := slyft.NegotiateAPIVersion(v.Min, v.Max, v.Current)
+			if err != nil {
+				return err
+			}
+			apiVersion, apiEndpoint = negotiated, cache.Config.endpoint(negotiated)
+			Log.Debugf("Using API version %d at %s", apiVersion, backendURL())
+			return nil
+		}
+	}
+
+	v := backendAPIVersions(backendURL())
+	if v == nil || v.Max == 0 {
+		return nil
+	}
+	negotiated, err := slyft.NegotiateAPIVersion(v.Min, v.Max, v.Max)
+	if err != nil {
+		return err
+	}
+	apiVersion = negotiated
+	Log.Debugf("Using API version %d at %s", apiVersion, backendURL())
+	return nil
+}
+
+// backendVersion is the answer of a backend to GET /version, see
+// backendAPIVersions. Max is 0 if it did not answer.
+type backendVersion struct {
+	Min, Max  int
+	CheckedAt time.Time
+}
+
+func backendVersionsFile() string {
+	return configPath("api-versions.json")
+}
+
+// backendAPIVersions returns the API versions supported by backend. The
+// answer is cached for updateCheckTTL, and a backend that does not answer
+// is asked again after updateCheckRetry.
+func backendAPIVersions(backend string) *backendVersion {
+	versions := map[string]*backendVersion{}
+	if b, err := ioutil.ReadFile(backendVersionsFile()); err == nil {
+		if err := json.Unmarshal(b, &versions); err != nil {
+			Log.Debugf("Ignoring %s: %s", backendVersionsFile(), err)
+		}
+	}
+	if v := versions[backend]; v != nil {
+		age := time.Since(v.CheckedAt)
+		if (v.Max != 0 && age < updateCheckTTL) || age < updateCheckRetry {
+			return v
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(requestContext(), updateCheckTimeout)
+	defer cancel()
+	v := &backendVersion{CheckedAt: time.Now()}
+	sv, err := slyft.NewClient(backend, httpClient(), nil).ServerVersion(ctx)
+	if err != nil {
+		Log.Debugf("Unable to get the API versions of %s: %s", backend, err)
+	} else {
+		v.Min, v.Max = sv.APIVersion.Min, sv.APIVersion.Max
+	}
+	versions[backend] = v
+	b, err := json.MarshalIndent(versions, "", "	")
+	if err == nil {
+		err = writeFileAtomic(backendVersionsFile(), b)
+	}
+	if err != nil {
+		Log.Debugf("Unable to cache the API versions: %s", err)
+	}
+	return v
 }
 
 type UpdateCheckResult struct {
@@ -36,9 +160,92 @@ type UpdateCheckResult struct {
 	MustUpdate   bool
 }
 
-func getConfigJson() (*configJson, error) {
+// cachedConfigJson is the config JSON as last fetched and verified.
+type cachedConfigJson struct {
+	Config *configJson `json:",omitempty"`
+	// when Config was fetched
+	FetchedAt time.Time
+	// time of the last attempt, successful or not
+	CheckedAt time.Time
+}
+
+func configCacheFile() string {
+	return configPath("update-check.json")
+}
+
+// readConfigCache returns the cached config JSON, or an empty cache if
+// there is none.
+func readConfigCache() *cachedConfigJson {
+	var c cachedConfigJson
+	b, err := ioutil.ReadFile(configCacheFile())
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil {
+		Log.Debugf("No cached config JSON: %s", err)
+		return &cachedConfigJson{}
+	}
+	return &c
+}
+
+func (c *cachedConfigJson) write() error {
+	b, err := json.MarshalIndent(c, "", "	")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(configCacheFile(), b)
+}
+
+// usable reports whether the cached config JSON has not expired.
+func (c *cachedConfigJson) usable() bool {
+	return c.Config != nil && !c.Config.expired()
+}
+
+// fresh reports whether the cached config JSON is recent enough to be
+// enforced, see UpdateCheck.
+func (c *cachedConfigJson) fresh() bool {
+	return c.usable() && time.Since(c.FetchedAt) < updateCheckTTL
+}
+
+// refresh fetches the config JSON and updates the cache. If that fails,
+// the cache keeps the last verified config JSON.
+func (c *cachedConfigJson) refresh(ctx context.Context) error {
+	config, err := getConfigJson(ctx)
+	c.CheckedAt = time.Now()
+	if err == nil {
+		c.Config, c.FetchedAt = config, c.CheckedAt
+	}
+	if err := c.write(); err != nil {
+		Log.Debugf("Unable to cache the config JSON: %s", err)
+	}
+	return err
+}
+
+func updateCheckDisabled() bool {
+	return (fNoUpdateCheck != nil && *fNoUpdateCheck) || currentSettings().NoUpdateCheck
+}
+
+// latestConfigJson fetches the config JSON, falling back to the cached one
+// if that fails and the cached one has not expired.
+func latestConfigJson(ctx context.Context) (*configJson, error) {
+	cache := readConfigCache()
+	err := cache.refresh(ctx)
+	if err == nil {
+		return cache.Config, nil
+	}
+	if !cache.usable() {
+		return nil, err
+	}
+	Log.Warningf("Using the config JSON of %s: %s", cache.FetchedAt.Local().Format("2006-01-02 15:04"), err)
+	return cache.Config, nil
+}
+
+// getConfigJson fetches the config JSON. It must be signed with
+// signingPublicKey, the raw Ed25519 signature being at configJsonURL +
+// ".sig", and must have an expiry date that has not passed.
+func getConfigJson(ctx context.Context) (*configJson, error) {
 	config := &configJson{}
-	resp, err := getJson(CONFIG_JSON_URL)
+	resp, err := getJson(ctx, configJsonURL)
 	if err != nil {
 		return config, err
 	}
@@ -50,18 +257,100 @@ func getConfigJson() (*configJson, error) {
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return config, err
+	}
+	sig, err := download(ctx, configJsonURL+".sig")
+	if err != nil {
+		return config, err
+	}
+	if err := verifySignature(signingPublicKey, body, sig); err != nil {
+		return config, fmt.Errorf("Config JSON %w: %s", errUnverified, err)
+	}
 
 	if err := json.Unmarshal(body, &config); err != nil {
 		return config, err
 	}
+	if config.Expires.IsZero() {
+		return config, errors.New("Config JSON has no expiry date")
+	}
+	if config.expired() {
+		return config, fmt.Errorf("Config JSON has expired (%s)", config.Expires.Format(time.RFC3339))
+	}
 	return config, nil
 }
 
-func UpdateCheck(appVersion string) error {
-	config, err := getConfigJson()
-	if err != nil {
-		return err
+// UpdateCheck checks appVersion against the cached config JSON and returns
+// an error if it must be updated. A stale cache is still enforced until it
+// expires, and refreshed in the background: the returned function waits for
+// that (at most updateCheckTimeout) and tells about a new version, which is
+// then refused from the next command on. Only without a usable cache, or
+// if the stale cache refuses appVersion, the config JSON is fetched before
+// the command runs.
+func UpdateCheck(appVersion string) (func(), error) {
+	cache := readConfigCache()
+	if cache.fresh() || time.Since(cache.CheckedAt) < updateCheckRetry {
+		if !cache.usable() {
+			return func() {}, nil
+		}
+		return func() {}, checkVersion(appVersion, cache.Config, false)
+	}
+
+	if !cache.usable() || checkVersion(appVersion, cache.Config, false) != nil {
+		ctx, cancel := context.WithTimeout(requestContext(), updateCheckTimeout)
+		defer cancel()
+		if err := cache.refresh(ctx); err != nil {
+			logUpdateCheckError(err)
+		}
+		if !cache.usable() {
+			return func() {}, nil
+		}
+		return func() {}, checkVersion(appVersion, cache.Config, cache.fresh())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(requestContext(), updateCheckTimeout)
+		defer cancel()
+		done <- cache.refresh(ctx)
+	}()
+	return func() {
+		if err := <-done; err != nil {
+			logUpdateCheckError(err)
+			return
+		}
+		if err := checkVersion(appVersion, cache.Config, true); err != nil {
+			Log.Error(err)
+		}
+	}, nil
+}
+
+// logUpdateCheckError logs why the update check failed. Network errors are
+// expected offline, config JSON that cannot be verified is not.
+func logUpdateCheckError(err error) {
+	if errors.Is(err, errUnverified) {
+		Log.Warningf("Update check failed: %s", err)
+		return
 	}
+	Log.Debugf("Update check failed: %s", err)
+}
+
+// checkVersion returns an error if config says that appVersion must be
+// updated. If notify is set, it also tells about a newer version.
+func checkVersion(appVersion string, config *configJson, notify bool) error {
+	res := compareVersion(appVersion, config)
+	if notify {
+		displayUpdateCheck(res)
+	}
+	if res.MustUpdate == true {
+		return errors.New(
+			fmt.Sprintf("You need to update your application with `slyft self-update`. Your version: %v, latest version: %v", appVersion, config.ClientVersion.Latest),
+		)
+	}
+	return nil
+}
+
+func compareVersion(appVersion string, config *configJson) *UpdateCheckResult {
 	res := &UpdateCheckResult{}
 	if version.Compare(appVersion, config.ClientVersion.Latest, "<") {
 		res.ShouldUpdate = true
@@ -69,13 +358,25 @@ func UpdateCheck(appVersion string) error {
 	if stringInSlice(appVersion, config.ClientVersion.Update) {
 		res.MustUpdate = true
 	}
-	displayUpdateCheck(res)
-	if res.MustUpdate == true {
-		return errors.New(
-			fmt.Sprintf("You need to update your application. Your version: %v, latest version: %v", appVersion, config.ClientVersion.Latest),
-		)
+	return res
+}
+
+// updateVerdict returns the result of the update check for appVersion
+// according to the cache: "up-to-date", "update-available",
+// "update-required", or "unknown" if the cache has expired.
+func updateVerdict(appVersion string) string {
+	cache := readConfigCache()
+	if !cache.usable() {
+		return "unknown"
 	}
-	return nil
+	res := compareVersion(appVersion, cache.Config)
+	switch {
+	case res.MustUpdate:
+		return "update-required"
+	case res.ShouldUpdate:
+		return "update-available"
+	}
+	return "up-to-date"
 }
 
 func displayUpdateCheck(res *UpdateCheckResult) {
@@ -83,24 +384,23 @@ func displayUpdateCheck(res *UpdateCheckResult) {
 		return
 	}
 	if res.MustUpdate {
-		Log.Info("Your version is outdated, you need to update before you can continue.")
+		fmt.Fprintln(os.Stderr, "Your version is outdated, you need to update before you can continue.")
 		return
 	}
 	if res.ShouldUpdate {
-		Log.Info("A newer version is available, consider updating.")
+		fmt.Fprintln(os.Stderr, "A newer version is available, consider updating.")
 	}
 }
 
-func getJson(url string) (*http.Response, error) {
+func getJson(ctx context.Context, url string) (*http.Response, error) {
 	b := new(bytes.Buffer)
-	req, err := http.NewRequest("GET", url, b)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, b)
 	if err != nil {
 		Log.Critical("Failed to create a request: " + err.Error())
 		return nil, err
 	}
 	req.Header.Add("Content-Type", "application/json; charset=utf-8")
-	client := &http.Client{}
-	return client.Do(req)
+	return httpClient().Do(req)
 }
 
 func ensureValidResponse(resp *http.Response) error {
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thingforward/slyft-cli/slyft"
+)
+
+// signedConfigServer serves the config JSON returned by config, with an
+// expiry added and signed with a new signingPublicKey. The returned
+// function stops the server and restores the key.
+func signedConfigServer(t *testing.T, config func() string) (*httptest.Server, func()) {
+	key, restore := withSigningKey(t)
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slyft-config.json":
+			var c map[string]interface{}
+			json.Unmarshal([]byte(config()), &c)
+			if _, ok := c["expires"]; !ok {
+				c["expires"] = time.Now().Add(30 * 24 * time.Hour)
+			}
+			body, _ = json.Marshal(c)
+			w.Write(body)
+		case "/slyft-config.json.sig":
+			w.Write(ed25519.Sign(key, body))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return ts, func() {
+		ts.Close()
+		restore()
+	}
+}
+
+func TestUpdateCheck(t *testing.T) {
+	defer withTempHome(t)()
+
+	hits := 0
+	ts, stop := signedConfigServer(t, func() string {
+		hits++
+		return `{"client_version": {"latest": "0.4.0", "update": ["0.3.0"]}}`
+	})
+	defer stop()
+	defer func(url string) { configJsonURL = url }(configJsonURL)
+	configJsonURL = ts.URL + "/slyft-config.json"
+
+	check := func(v string) error {
+		wait, err := UpdateCheck(v)
+		wait()
+		return err
+	}
+
+	// without a cache, the config JSON is fetched and enforced right away
+	if err := check("0.3.0"); err == nil {
+		t.Error("Must refuse version that must be updated")
+	}
+	if hits != 1 || !readConfigCache().fresh() {
+		t.Fatalf("Must fetch and cache the config JSON, got %d requests", hits)
+	}
+
+	// with fresh data, the cache is used without asking again
+	if err := check("0.3.0"); err == nil {
+		t.Error("Must refuse version that must be updated")
+	}
+	if err := check("0.3.1"); err != nil {
+		t.Errorf("Must accept version %v", err)
+	}
+	if hits != 1 {
+		t.Errorf("Must use the cache, got %d requests", hits)
+	}
+
+	// stale data is enforced, and refreshed in the background
+	c := readConfigCache()
+	c.Config.ClientVersion.Update = nil
+	c.FetchedAt = time.Now().Add(-updateCheckTTL)
+	c.CheckedAt = c.FetchedAt
+	c.write()
+	if err := check("0.3.0"); err != nil || hits != 2 {
+		t.Errorf("Must enforce stale data and refresh it, got %d requests, %v", hits, err)
+	}
+	if err := check("0.3.0"); err == nil || hits != 2 {
+		t.Errorf("Must refuse version from refreshed data, got %d requests, %v", hits, err)
+	}
+
+	// a failed refresh keeps the stale data
+	c = readConfigCache()
+	c.FetchedAt = time.Now().Add(-updateCheckTTL)
+	c.CheckedAt = c.FetchedAt
+	c.write()
+	ts.Close()
+	if err := check("0.3.0"); err == nil {
+		t.Error("Must enforce stale data")
+	}
+
+	// and is not retried right away
+	if c := readConfigCache(); time.Since(c.CheckedAt) > time.Minute || c.Config == nil {
+		t.Errorf("Must remember failed check and keep data, got %+v", c)
+	}
+
+	// expired data is not enforced
+	c = readConfigCache()
+	c.Config.Expires = time.Now().Add(-time.Minute)
+	c.write()
+	if err := check("0.3.0"); err != nil {
+		t.Errorf("Must not enforce expired data: %v", err)
+	}
+}
+
+func TestNegotiateAPI(t *testing.T) {
+	defer withTempHome(t)()
+	defer func() { apiVersion, apiEndpoint = slyft.MaxAPIVersion, "" }()
+
+	write := func(config string) {
+		c := &cachedConfigJson{Config: &configJson{Expires: time.Now().Add(time.Hour)}, FetchedAt: time.Now()}
+		if err := json.Unmarshal([]byte(config), c.Config); err != nil {
+			t.Fatal(err)
+		}
+		c.write()
+	}
+
+	write(`{"api_version": {"min": 0, "max": 3, "current": 2}, "end_points": [{"0": "https://v0.example.com"}, {"1": "https://v1.example.com"}]}`)
+	if err := negotiateAPI(); err != nil || apiVersion != slyft.MaxAPIVersion || backendURL() != "https://v1.example.com" {
+		t.Errorf("Must pick highest common version, got %d %s %v", apiVersion, backendURL(), err)
+	}
+
+	write(`{"api_version": {"min": 1000, "max": 1001, "current": 1000}}`)
+	err := negotiateAPI()
+	if _, ok := err.(*slyft.VersionMismatchError); !ok || !strings.Contains(err.Error(), "update the client") {
+		t.Errorf("Must report a client too old, got %v", err)
+	}
+
+	// explicitly configured backends are asked, once
+	hits, min := 0, 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		fmt.Fprintf(w, `{"version": "2.0.0", "api_version": {"min": %d, "max": %d}}`, min, min+1)
+	}))
+	defer ts.Close()
+	os.Setenv("SLYFTBACKEND", ts.URL)
+	defer os.Unsetenv("SLYFTBACKEND")
+	apiVersion, apiEndpoint = 0, ""
+	for i := 0; i < 2; i++ {
+		if err := negotiateAPI(); err != nil || apiVersion != slyft.MaxAPIVersion || backendURL() != ts.URL {
+			t.Errorf("Must negotiate with configured backend, got %d %s %v", apiVersion, backendURL(), err)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("Must cache the API versions of the backend, got %d requests", hits)
+	}
+
+	// and their versions are checked as well
+	min = 1000
+	os.Remove(backendVersionsFile())
+	if err := negotiateAPI(); err == nil {
+		t.Error("Must report a mismatch with the configured backend")
+	}
+
+	// a backend that does not tell keeps the defaults, and is asked again later
+	ts.Config.Handler = http.NotFoundHandler()
+	os.Remove(backendVersionsFile())
+	apiVersion = slyft.MaxAPIVersion
+	if err := negotiateAPI(); err != nil || apiVersion != slyft.MaxAPIVersion {
+		t.Errorf("Must keep defaults, got %d %v", apiVersion, err)
+	}
+	if v := backendAPIVersions(ts.URL); v.Max != 0 || time.Since(v.CheckedAt) > time.Minute {
+		t.Errorf("Must remember the failed request, got %+v", v)
+	}
+}
+
+func TestSignedConfigJson(t *testing.T) {
+	defer withTempHome(t)()
+
+	config := `{"client_version": {"latest": "0.4.0"}}`
+	ts, stop := signedConfigServer(t, func() string { return config })
+	defer stop()
+	defer func(url string) { configJsonURL = url }(configJsonURL)
+	configJsonURL = ts.URL + "/slyft-config.json"
+
+	c, err := latestConfigJson(context.Background())
+	if err != nil || c.ClientVersion.Latest != "0.4.0" {
+		t.Fatalf("Must accept signed config JSON, got %+v %v", c, err)
+	}
+
+	// config JSON without expiry is refused
+	config = `{"client_version": {"latest": "0.4.0"}, "expires": null}`
+	if _, err := getConfigJson(context.Background()); err == nil || !strings.Contains(err.Error(), "expiry") {
+		t.Errorf("Must refuse config JSON without expiry, got %v", err)
+	}
+
+	// expired config JSON is refused, and the cached one is used instead
+	config = fmt.Sprintf(`{"client_version": {"latest": "0.5.0"}, "expires": %q}`, time.Now().Add(-time.Hour).Format(time.RFC3339))
+	if _, err := getConfigJson(context.Background()); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Must refuse expired config JSON, got %v", err)
+	}
+	if c, err := latestConfigJson(context.Background()); err != nil || c.ClientVersion.Latest != "0.4.0" {
+		t.Errorf("Must fall back to cached config JSON, got %+v %v", c, err)
+	}
+
+	// as is config JSON signed with another key
+	config = `{"client_version": {"latest": "0.5.0"}}`
+	_, restore := withSigningKey(t)
+	defer restore()
+	if _, err := getConfigJson(context.Background()); !errors.Is(err, errUnverified) {
+		t.Errorf("Must refuse config JSON with wrong signature, got %v", err)
+	}
+
+	// and by builds without a signing key
+	signingPublicKey = ""
+	if _, err := getConfigJson(context.Background()); !errors.Is(err, errUnverified) || !strings.Contains(err.Error(), "no release signing key") {
+		t.Errorf("Must refuse config JSON without signing key, got %v", err)
+	}
+	if c, err := latestConfigJson(context.Background()); err != nil || c.ClientVersion.Latest != "0.4.0" {
+		t.Errorf("Must fall back to cached config JSON, got %+v %v", c, err)
+	}
+
+	// but not to an expired cache
+	cache := readConfigCache()
+	cache.Config.Expires = time.Now().Add(-time.Minute)
+	cache.write()
+	if _, err := latestConfigJson(context.Background()); err == nil {
+		t.Error("Must not use expired cache")
+	}
+}
+
+func TestUpdateVerdict(t *testing.T) {
+	defer withTempHome(t)()
+
+	if v := updateVerdict("0.3.0"); v != "unknown" {
+		t.Errorf("Expected unknown without cache, got %s", v)
+	}
+	c := &cachedConfigJson{Config: &configJson{Expires: time.Now().Add(time.Hour)}, FetchedAt: time.Now()}
+	c.Config.ClientVersion.Latest = "0.4.0"
+	c.Config.ClientVersion.Update = []string{"0.2.0"}
+	c.write()
+	for appVersion, want := range map[string]string{"0.4.0": "up-to-date", "0.3.0": "update-available", "0.2.0": "update-required"} {
+		if v := updateVerdict(appVersion); v != want {
+			t.Errorf("%s: expected %s, got %s", appVersion, want, v)
+		}
+	}
+}
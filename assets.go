@@ -1,38 +1,38 @@
 package main
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"bytes"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"strings"
-	"time"
 
 	cli "github.com/jawher/mow.cli"
+	"github.com/thingforward/slyft-cli/slyft"
 )
 
-type Asset struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	ProjectId   int       `json:"project_id"`
-	ProjectName string    `json:"project_name"`
-	Origin      string    `json:"origin"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+// assetModel makes an asset deletable through DeleteApiModel.
+type assetModel struct {
+	*slyft.Asset
 }
 
-func (a *Asset) getName() string {
+func (a assetModel) getName() string {
 	return a.Name
 }
 
-func (a *Asset) Display() { // String?
+func (a assetModel) remove() error {
+	return API().Assets.Delete(requestContext(), a.Asset)
+}
+
+func displayAsset(a *slyft.Asset) {
 	if a == nil {
 		return
 	}
+	if outputJSON() {
+		printJSON(a)
+		return
+	}
 
 	data := [][]string{
 		[]string{"Key", "Value"},
@@ -49,14 +49,19 @@ func (a *Asset) Display() { // String?
 		markdownTable(&data))
 }
 
-func DisplayAssets(assets []Asset) {
+func DisplayAssets(assets []slyft.Asset) {
+	if outputJSON() {
+		printJSON(assets)
+		return
+	}
+
 	if len(assets) == 0 {
 		fmt.Println("No assets found")
 		return
 	}
 
 	if len(assets) == 1 {
-		assets[0].Display()
+		displayAsset(&assets[0])
 		return
 	}
 
@@ -67,35 +72,19 @@ func DisplayAssets(assets []Asset) {
 		data = append(data, []string{fmt.Sprintf("%d", i+1), a.Name, a.UpdatedAt.String(), a.ProjectName, a.Origin})
 	}
 
-	fmt.Fprintf(os.Stdout, markdownTable(&data))
-}
-
-func extractAssetsFromBody(body []byte) ([]Asset, error) {
-	Log.Debugf("body=%v", string(body))
-	assets := make([]Asset, 0)
-	if err := json.Unmarshal(body, &assets); err != nil {
-		return nil, err
-	}
-	return assets, nil
-}
-
-func extractAssetFromBody(body []byte) ([]Asset, error) {
-	Log.Debugf("body=%v", string(body))
-	a := &Asset{}
-	if err := json.Unmarshal(body, &a); err != nil {
-		return nil, err
-	}
-	return []Asset{*a}, nil
+	fmt.Fprint(os.Stdout, markdownTable(&data))
 }
 
-func chooseAsset(endpoint string, askUser bool, message string, count int) (*Asset, error) {
-	resp, err := Do(endpoint, "GET", nil)
-	if err != nil {
-		return nil, err
+// chooseAsset lists the assets of project p (or of all projects if p is nil)
+// and lets the user pick one of them.
+func chooseAsset(p *slyft.Project, askUser bool, message string, count int) (*slyft.Asset, error) {
+	var assets []slyft.Asset
+	var err error
+	if p == nil {
+		assets, err = API().Assets.ListAll(requestContext())
+	} else {
+		assets, err = API().Assets.List(requestContext(), p.ID)
 	}
-	defer resp.Body.Close()
-	assets, err := extractAssetFromResponse(resp, http.StatusOK, true)
-
 	if err != nil {
 		return nil, err
 	}
@@ -128,106 +117,112 @@ func chooseAsset(endpoint string, askUser bool, message string, count int) (*Ass
 		return nil, err
 	}
 
-	if choice > len(assets) {
+	if choice < 1 || choice > len(assets) {
 		return nil, errors.New("Plese choose a number from the first column")
 	}
 
 	return &assets[choice-1], nil
 }
 
-type AssetPost struct {
-	Name  string `json:"name"`
-	Asset string `json:"asset"` // note: this will be base64 string
-}
-
-type AssetParam struct {
-	Asset AssetPost `json:"asset"`
-}
-
-type AssetNameString struct {
-	AssetNameString string `json:"asset_name"`
-}
-
-func creatAssetParam(file string) (*AssetParam, error) {
+// postAsset uploads file as asset of project p.
+func postAsset(file string, p *slyft.Project) (*slyft.Asset, error) {
 	// read the file content (use ioutil)
 	bytes, err := ioutil.ReadFile(file)
 	if err != nil {
-		return nil, err
+		return nil, &stepError{"Reading file", err}
 	}
 
 	mimeType, err := preflightAsset(&bytes, file)
 	if err != nil {
-		return nil, err
+		return nil, &stepError{"Checking file", err}
 	}
 
-	return &AssetParam{
-		AssetPost{
-			Name:  file,
-			Asset: "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(bytes),
-		},
-	}, nil
+	a, err := API().Assets.Upload(requestContext(), p.ID, file, bytes, mimeType)
+	if err != nil {
+		return nil, &stepError{"Creating asset", err}
+	}
+	return a, nil
 }
 
-func readFileAndPostAsset(file string, p *Project) error {
-	assetParam, err := creatAssetParam(file)
+func readFileAndPostAsset(file string, p *slyft.Project) error {
+	a, err := postAsset(file, p)
 	if err != nil {
-		ReportError("Creating request", err)
+		reportStepError(err)
 		return err
 	}
 
-	resp, err := Do(p.AssetsUrl(), "POST", assetParam)
+	displayAsset(a)
+	return nil
+}
+
+// downloadAsset saves asset file of project p to a local file of the same
+// name.
+func downloadAsset(file string, p *slyft.Project) error {
+	// download into memory first, so that a failed download does not
+	// leave an empty file behind
+	var b bytes.Buffer
+	err := API().Assets.Download(requestContext(), p.ID, file, &b)
 	if err != nil {
-		ReportError("Contacting server", err)
-		return err
+		return &stepError{"Downloading asset", err}
 	}
-	defer resp.Body.Close()
-	assets, err := extractAssetFromResponse(resp, http.StatusCreated, false)
-	if err != nil {
-		ReportError("Creating asset", err)
-		return err
+
+	if err := ioutil.WriteFile(file, b.Bytes(), 0644); err != nil {
+		return &stepError{"Writing asset file", err}
 	}
+	return nil
+}
 
-	if len(assets) == 1 {
-		assets[0].Display()
+func getAssetAndSaveToFile(file string, p *slyft.Project) error {
+	if err := downloadAsset(file, p); err != nil {
+		reportStepError(err)
+		return err
 	}
+	fmt.Printf("Downloaded %s\n", file)
 	return nil
 }
 
-func getAssetAndSaveToFile(file string, p *Project) {
-	resp, err := Do(p.AssetstoreUrl(), "GET", &AssetNameString{file})
-	if err != nil {
-		ReportError("Downloading asset", err)
-		return
+// uploadAssets uploads files one by one, or with a summary table when
+// parallel > 1 or the output is JSON, and returns the number of failed
+// files.
+func uploadAssets(files []string, p *slyft.Project, parallel int) int {
+	if parallel > 1 || outputJSON() {
+		return displayTransfers(transferFiles(files, parallel, func(file string) error {
+			_, err := postAsset(file, p)
+			return err
+		}))
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == 200 {
-		// stream body to file of this name
-		out, err := os.Create(file)
-		if err != nil {
-			ReportError("Creating asset file", err)
-			return
+	failed := 0
+	for _, file := range files {
+		fmt.Printf("Uploading %s ...\n", file)
+		if readFileAndPostAsset(file, p) != nil {
+			failed++
 		}
-		defer out.Close()
-		_, err = io.Copy(out, resp.Body)
-		if err != nil {
-			ReportError("Writing asset file", err)
-			return
-		}
-		fmt.Printf("Downloaded %s\n", file)
-	} else {
-		ReportError("Downloading asset", nil)
 	}
+	reportFailures(failed, len(files))
+	return failed
 }
 
-func getAllAssets(p *Project) ([]Asset, error) {
-	resp, err := Do(p.AssetsUrl(), "GET", nil)
-	if err != nil {
-		return nil, err
+// downloadAssets is the counterpart of uploadAssets.
+func downloadAssets(files []string, p *slyft.Project, parallel int) int {
+	if parallel > 1 || outputJSON() {
+		return displayTransfers(transferFiles(files, parallel, func(file string) error {
+			return downloadAsset(file, p)
+		}))
+	}
+
+	failed := 0
+	for _, file := range files {
+		if getAssetAndSaveToFile(file, p) != nil {
+			failed++
+		}
 	}
-	defer resp.Body.Close()
-	assets, err := extractAssetFromResponse(resp, http.StatusOK, true)
+	reportFailures(failed, len(files))
+	return failed
+}
 
+func getAllAssets(p *slyft.Project) ([]slyft.Asset, error) {
+	assets, err := API().Assets.List(requestContext(), p.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -239,37 +234,25 @@ func getAllAssets(p *Project) ([]Asset, error) {
 	return assets, nil
 }
 
-func removeSingleFileFromAsset(assets []Asset, file string, p *Project) {
-
-	for _, asset := range assets {
-		if asset.Name == file {
+func removeSingleFileFromAsset(assets []slyft.Asset, file string) {
+	for i := range assets {
+		if assets[i].Name == file {
 			fmt.Printf("Deleting asset %s\n", file)
 
-			resp, err := Do(asset.EndPoint(), "DELETE", &AssetNameString{file})
-			Log.Debugf("resp=%#v", resp)
-			if err != nil {
-				Log.Debugf("err=%#v", err)
+			err := API().Assets.Delete(requestContext(), &assets[i])
+			switch {
+			case slyft.IsNotFound(err):
+				fmt.Printf("Unable to delete asset with name %s\n", file)
+			case err != nil:
 				ReportError("Removing asset", err)
-				return
-			}
-			defer resp.Body.Close()
-
-			if err != nil || resp.StatusCode != http.StatusNoContent {
-				if resp.StatusCode == http.StatusNotFound {
-					fmt.Printf("Unable to delete asset with name %s\n", file)
-				} else {
-					fmt.Printf("Something went wrong. Please try again. (ResponseCode: %d)\n", resp.StatusCode)
-				}
-			} else {
+			default:
 				fmt.Println("Was successfully deleted")
 			}
-
 			return
 		}
 	}
 
 	fmt.Printf("Unable to delete asset with name %s\n", file)
-
 }
 
 func listAssets(cmd *cli.Cmd) {
@@ -280,7 +263,7 @@ func listAssets(cmd *cli.Cmd) {
 	cmd.Action = func() {
 		*name = strings.TrimSpace(*name)
 		if *all {
-			chooseAsset("/v1/assets", false, "", 0)
+			chooseAsset(nil, false, "", 0)
 			return
 		} else {
 			if *name == "" {
@@ -294,15 +277,16 @@ func listAssets(cmd *cli.Cmd) {
 			ReportError("Choosing the project", err)
 			return
 		}
-		if _, err = chooseAsset(p.AssetsUrl(), false, "", 0); err != nil {
+		if _, err = chooseAsset(p, false, "", 0); err != nil {
 			ReportError("Choosing the asset", err)
 		}
 	}
 }
 
 func addAsset(cmd *cli.Cmd) {
-	cmd.Spec = "[--project] [--file] [INPUTFILES...]"
+	cmd.Spec = "[--project] [--parallel] [--file] [INPUTFILES...]"
 	name := cmd.StringOpt("project p", "", "Name (or part of it) of a project")
+	parallel := cmd.IntOpt("parallel", 1, "Number of files to upload at the same time")
 	// --file is kept as documentation relates on it, but will be deprecated
 	file := cmd.StringOpt("file f", "", "path to the file which you want as an asset")
 	files := cmd.StringsArg("INPUTFILES", nil, "Multiple files to upload as assets")
@@ -321,44 +305,43 @@ func addAsset(cmd *cli.Cmd) {
 			return
 		}
 
-		didProcessSomething := false
+		var todo []string
+		failed := 0
 		if file != nil && *file != "" {
-			*file = strings.TrimSpace(*file)
-			err := readFileAndPostAsset(*file, p)
-			if err == nil {
-				didProcessSomething = true
-			}
+			todo = append(todo, strings.TrimSpace(*file))
 		}
 		if files != nil {
 			for _, singleFile := range *files {
-				f, err := os.Open(singleFile)
-				fi, err := f.Stat()
-				defer f.Close()
+				fi, err := os.Stat(singleFile)
 				switch {
 				case err != nil:
 					fmt.Printf("Unable to read from %s, skipping\n", singleFile)
+					failed++
 				case fi.IsDir():
 					fmt.Printf("Is a directory: %s, skipping\n", singleFile)
+					failed++
 				default:
-					fmt.Printf("Uploading %s ...\n", singleFile)
-					err := readFileAndPostAsset(singleFile, p)
-					if err == nil {
-						didProcessSomething = true
-					}
+					todo = append(todo, singleFile)
 				}
 			}
 		}
 
-		if didProcessSomething == false {
+		if len(todo) == 0 {
 			fmt.Println("Need to specify --file or give valid files as arguments. Did not upload anything")
+		} else {
+			// failed uploads are reported by uploadAssets
+			failed += uploadAssets(todo, p, *parallel)
+		}
+		if failed > 0 {
+			cli.Exit(1)
 		}
-
 	}
 }
 
 func getAsset(cmd *cli.Cmd) {
-	cmd.Spec = "[--project] [--file] [FILES...]"
+	cmd.Spec = "[--project] [--parallel] [--file] [FILES...]"
 	name := cmd.StringOpt("project p", "", "Name (or part of it) of a project")
+	parallel := cmd.IntOpt("parallel", 1, "Number of assets to download at the same time")
 	file := cmd.StringOpt("file f", "", "name of the asset to be downloaded")
 	files := cmd.StringsArg("FILES", nil, "Multiple assets to download")
 
@@ -375,26 +358,22 @@ func getAsset(cmd *cli.Cmd) {
 			return
 		}
 
-		didProcessSomething := false
+		var todo []string
 		if file != nil && *file != "" {
-			*file = strings.TrimSpace(*file)
-			getAssetAndSaveToFile(*file, p)
-			didProcessSomething = true
+			todo = append(todo, strings.TrimSpace(*file))
 		}
 		if files != nil {
-			for _, singleFile := range *files {
-				getAssetAndSaveToFile(singleFile, p)
-				didProcessSomething = true
-			}
+			todo = append(todo, *files...)
 		}
-		if didProcessSomething == false {
+		if len(todo) == 0 {
 			fmt.Println("Need to specify --file or give valid files as arguments. Did not download anything")
+			return
 		}
-	}
-}
 
-func (ass *Asset) EndPoint() string {
-	return fmt.Sprintf("/v1/projects/%d/assets/%d", ass.ProjectId, ass.ID)
+		if downloadAssets(todo, p, *parallel) > 0 {
+			cli.Exit(1)
+		}
+	}
 }
 
 func removeAsset(cmd *cli.Cmd) {
@@ -409,10 +388,10 @@ func removeAsset(cmd *cli.Cmd) {
 			*name, _ = ReadProjectLock()
 		}
 
-		var ass *Asset
+		var ass *slyft.Asset
 		var err error
 		if *name == "" {
-			ass, err = chooseAsset("/v1/assets", true, "Which one shall be deleted: ", *count)
+			ass, err = chooseAsset(nil, true, "Which one shall be deleted: ", *count)
 		} else {
 			// first get the project, then get the pid, and make the call.
 			p, err2 := chooseProject(*name, "Which project's assets would you like to see: ")
@@ -426,7 +405,7 @@ func removeAsset(cmd *cli.Cmd) {
 				if err == nil {
 					// locate and delete files
 					for _, singleFile := range *files {
-						removeSingleFileFromAsset(assets, singleFile, p)
+						removeSingleFileFromAsset(assets, singleFile)
 					}
 				} else {
 					Log.Debugf("%#v", err)
@@ -434,7 +413,7 @@ func removeAsset(cmd *cli.Cmd) {
 				}
 			} else {
 				// choose interactive
-				ass, err = chooseAsset(p.AssetsUrl(), true, "Which one shall be removed: ", *count)
+				ass, err = chooseAsset(p, true, "Which one shall be removed: ", *count)
 
 				if err != nil {
 					ReportError("Choosing the asset", err)
@@ -442,7 +421,9 @@ func removeAsset(cmd *cli.Cmd) {
 				}
 				Log.Debugf("Choosen asset %#v", ass)
 
-				DeleteApiModel(ass)
+				if ass != nil {
+					DeleteApiModel(assetModel{ass})
+				}
 			}
 		}
 
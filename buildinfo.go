@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	cli "github.com/jawher/mow.cli"
+	"github.com/thingforward/slyft-cli/slyft"
+)
+
+// buildInfo is shown by `slyft version` and `slyft info`.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	// API versions supported by the client, and the one in use
+	APIVersion struct {
+		Min  int `json:"min"`
+		Max  int `json:"max"`
+		Used int `json:"used"`
+	} `json:"api_version"`
+	Backend string `json:"backend"`
+	// nil if the backend is not reachable
+	Server *slyft.ServerVersion `json:"server,omitempty"`
+	// see updateVerdict
+	UpdateCheck string `json:"update_check"`
+}
+
+// currentBuildInfo describes this binary. COMMIT and BUILD_DATE default
+// to the version control information Go records in module builds. If
+// askServer is set, the API version is negotiated and the backend is asked
+// for its version, waiting at most updateCheckTimeout.
+func currentBuildInfo(askServer bool) *buildInfo {
+	if askServer {
+		// `version` and `info` run without setupBackend
+		if err := negotiateAPI(); err != nil {
+			Log.Debugf("Unable to negotiate the API version: %s", err)
+		}
+	}
+	bi := &buildInfo{
+		Version:     VERSION,
+		Commit:      COMMIT,
+		BuildDate:   BUILD_DATE,
+		GoVersion:   runtime.Version(),
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		Backend:     backendURL(),
+		UpdateCheck: updateVerdict(VERSION),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && bi.Commit == "":
+				bi.Commit = s.Value
+			case s.Key == "vcs.time" && bi.BuildDate == "":
+				bi.BuildDate = s.Value
+			}
+		}
+	}
+	bi.APIVersion.Min, bi.APIVersion.Max, bi.APIVersion.Used = slyft.MinAPIVersion, slyft.MaxAPIVersion, apiVersion
+
+	if askServer {
+		ctx, cancel := context.WithTimeout(requestContext(), updateCheckTimeout)
+		defer cancel()
+		sv, err := API().ServerVersion(ctx)
+		if err != nil {
+			Log.Debugf("Unable to get the version of the backend: %s", err)
+		}
+		bi.Server = sv
+	}
+	return bi
+}
+
+func displayBuildInfo(bi *buildInfo) {
+	fmt.Printf("Version %s", bi.Version)
+	if bi.Commit != "" {
+		fmt.Printf(", commit %s", bi.Commit)
+	}
+	if bi.BuildDate != "" {
+		fmt.Printf(", built %s", bi.BuildDate)
+	}
+	fmt.Printf("\nBuilt with %s for %s/%s\n", bi.GoVersion, bi.OS, bi.Arch)
+	fmt.Printf("API version %d (supported: %d to %d) at %s\n", bi.APIVersion.Used, bi.APIVersion.Min, bi.APIVersion.Max, bi.Backend)
+	if bi.Server != nil {
+		fmt.Printf("Backend version %s (API version %d to %d)\n", bi.Server.Version, bi.Server.APIVersion.Min, bi.Server.APIVersion.Max)
+	} else {
+		fmt.Println("Backend version unknown")
+	}
+	fmt.Printf("Update check: %s\n", bi.UpdateCheck)
+}
+
+func showVersion(cmd *cli.Cmd) {
+	cmd.Spec = "[--json] [--offline]"
+	asJSON := cmd.BoolOpt("json", false, "Print as JSON (same as --output json)")
+	offline := cmd.BoolOpt("offline", false, "Do not ask the backend for its version")
+
+	cmd.Action = func() {
+		bi := currentBuildInfo(!*offline)
+		if *asJSON || outputJSON() {
+			printJSON(bi)
+			return
+		}
+		displayBuildInfo(bi)
+	}
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	cli "github.com/jawher/mow.cli"
+	"github.com/thingforward/slyft-cli/slyft"
+)
+
+// configKey describes a setting that can be changed with `slyft config`.
+// Command line flags take precedence over environment variables, which take
+// precedence over the active profile and the default profile.
+type configKey struct {
+	Name string
+	Desc string
+	// environment variable overriding the config file
+	Env string
+	// value used if the setting is given nowhere
+	Default string
+	// field returns a pointer to the setting: *string, *int, *bool, or
+	// **int for numbers where 0 is a valid value and nil is unset
+	field func(s *Settings) interface{}
+	// validate checks string values (optional)
+	validate func(v string) error
+}
+
+var configKeys = []configKey{
+	{"backend", "URL of the backend", "SLYFTBACKEND", slyft.DefaultBaseURL,
+		func(s *Settings) interface{} { return &s.Backend }, validateBackendURL},
+	{"output", "Output format: text or json", "SLYFT_OUTPUT", "text",
+		func(s *Settings) interface{} { return &s.Output }, oneOf("text", "json")},
+	{"project", "Project used if there is no .slyftproject", "SLYFT_PROJECT", "",
+		func(s *Settings) interface{} { return &s.Project }, nil},
+	{"timeout", "Max. seconds for a single request, 0 for no limit", "SLYFT_TIMEOUT", strconv.Itoa(int(slyft.DefaultTimeout.Seconds())),
+		func(s *Settings) interface{} { return &s.Timeout }, nil},
+	{"retry-attempts", "Total number of attempts for idempotent requests, 1 for no retries", "SLYFT_RETRY_ATTEMPTS", strconv.Itoa(slyft.DefaultRetryPolicy().MaxAttempts),
+		func(s *Settings) interface{} { return &s.RetryAttempts }, atLeast(1)},
+	{"retry-timeout", "Max. seconds spent on retrying a request, 0 for no limit", "SLYFT_RETRY_TIMEOUT", strconv.Itoa(int(slyft.DefaultRetryPolicy().Timeout.Seconds())),
+		func(s *Settings) interface{} { return &s.RetryTimeout }, nil},
+	{"ca-file", "PEM bundle of additional trusted CAs", "SLYFT_CA_FILE", "",
+		func(s *Settings) interface{} { return &s.CAFile }, fileExists},
+	{"client-cert", "PEM client certificate for mutual TLS", "SLYFT_CLIENT_CERT", "",
+		func(s *Settings) interface{} { return &s.ClientCert }, fileExists},
+	{"client-key", "PEM client key for mutual TLS", "SLYFT_CLIENT_KEY", "",
+		func(s *Settings) interface{} { return &s.ClientKey }, fileExists},
+	{"proxy", "URL of the HTTP(S) proxy", "SLYFT_PROXY", "",
+		func(s *Settings) interface{} { return &s.Proxy }, validateProxyURL},
+	{"insecure", "Do not verify TLS certificates (testing only)", "SLYFT_INSECURE", "false",
+		func(s *Settings) interface{} { return &s.Insecure }, nil},
+	{"no-update-check", "Skip the check for a new version", "SLYFT_NO_UPDATE_CHECK", "false",
+		func(s *Settings) interface{} { return &s.NoUpdateCheck }, nil},
+	{"update-url", "URL of the releases for self-update", "SLYFT_UPDATE_URL", RELEASES_URL,
+		func(s *Settings) interface{} { return &s.UpdateURL }, validateUpdateURL},
+	{"credential-store", "Where credentials are kept: plaintext, file (encrypted) or helper", "SLYFT_CREDENTIAL_STORE", "plaintext",
+		func(s *Settings) interface{} { return &s.CredentialStore }, oneOf("plaintext", "file", "helper")},
+	{"credential-helper", "Command of the credential helper", "SLYFT_CREDENTIAL_HELPER", "",
+		func(s *Settings) interface{} { return &s.CredentialHelper }, validateCommand},
+}
+
+func findConfigKey(name string) (*configKey, error) {
+	for i := range configKeys {
+		if configKeys[i].Name == name {
+			return &configKeys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown key %s, see `slyft config list`", name)
+}
+
+// get returns the setting formatted as string, or "" if it is not set.
+func (k *configKey) get(s *Settings) string {
+	switch f := k.field(s).(type) {
+	case *string:
+		return *f
+	case *int:
+		if *f != 0 {
+			return strconv.Itoa(*f)
+		}
+	case **int:
+		if *f != nil {
+			return strconv.Itoa(**f)
+		}
+	case *bool:
+		if *f {
+			return "true"
+		}
+	}
+	return ""
+}
+
+// set validates v and stores it in s.
+func (k *configKey) set(s *Settings, v string) error {
+	if k.validate != nil {
+		if err := k.validate(v); err != nil {
+			return err
+		}
+	}
+	return k.assign(s, v)
+}
+
+// assign parses v and stores it in s without further validation.
+func (k *configKey) assign(s *Settings, v string) error {
+	switch f := k.field(s).(type) {
+	case *string:
+		*f = v
+	case *int:
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			return fmt.Errorf("%s must be a number >= 0, got %s", k.Name, v)
+		}
+		*f = i
+	case **int:
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			return fmt.Errorf("%s must be a number >= 0, got %s", k.Name, v)
+		}
+		*f = &i
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %s", k.Name, v)
+		}
+		*f = b
+	}
+	return nil
+}
+
+func (k *configKey) unset(s *Settings) {
+	switch f := k.field(s).(type) {
+	case *string:
+		*f = ""
+	case *int:
+		*f = 0
+	case **int:
+		*f = nil
+	case *bool:
+		*f = false
+	}
+}
+
+// copyIfSet copies the setting from src to dst unless it is unset in src.
+func (k *configKey) copyIfSet(dst, src *Settings) {
+	if v := k.get(src); v != "" {
+		k.assign(dst, v)
+	}
+}
+
+// validateSettings checks all settings stored in s, e.g. after editing the
+// config file by hand.
+func validateSettings(s *Settings) error {
+	for i := range configKeys {
+		k := &configKeys[i]
+		if v := k.get(s); v != "" {
+			if err := k.set(&Settings{}, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookupSetting returns the value of k in effect for commands without
+// command line flags, and where it comes from.
+func lookupSetting(sr *SlyftRC, k *configKey) (string, string) {
+	if v := os.Getenv(k.Env); v != "" {
+		return v, "environment (" + k.Env + ")"
+	}
+	if p, _ := sr.profile(); p != nil {
+		if v := k.get(&p.Settings); v != "" {
+			return v, "profile " + sr.profileName()
+		}
+	}
+	if v := k.get(&sr.Settings); v != "" {
+		return v, "config file"
+	}
+	return k.Default, "default"
+}
+
+// currentSettings returns the settings of the active profile with
+// environment variables applied. Command line flags are applied by callers.
+func currentSettings() Settings {
+	sr, _ := readConfig()
+	return sr.effectiveSettings(sr.profileName())
+}
+
+// effectiveSettings returns the settings of profile with environment
+// variables applied.
+func (sr *SlyftRC) effectiveSettings(profile string) Settings {
+	s := sr.settingsOf(profile)
+	for i := range configKeys {
+		k := &configKeys[i]
+		if v := os.Getenv(k.Env); v != "" {
+			if err := k.assign(&s, v); err != nil {
+				Log.Warningf("Ignoring %s: %s", k.Env, err)
+			}
+		}
+	}
+	return s
+}
+
+func validateBackendURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Invalid backend URL " + s + ", expected e.g. https://api.slyft.io/")
+	}
+	return nil
+}
+
+func validateUpdateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Invalid update URL " + s + ", expected e.g. " + RELEASES_URL)
+	}
+	return nil
+}
+
+func validateProxyURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("Invalid proxy URL " + s + ", expected e.g. http://proxy.example.com:3128")
+	}
+	return nil
+}
+
+func fileExists(s string) error {
+	_, err := os.Stat(s)
+	return err
+}
+
+func atLeast(min int) func(string) error {
+	return func(v string) error {
+		if i, err := strconv.Atoi(v); err == nil && i < min {
+			return fmt.Errorf("Invalid value %s, expected at least %d", v, min)
+		}
+		return nil
+	}
+}
+
+func oneOf(values ...string) func(string) error {
+	return func(v string) error {
+		for _, value := range values {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("Invalid value %s, expected one of %s", v, strings.Join(values, ", "))
+	}
+}
+
+// settingsToChange returns the settings of the active profile for
+// modification.
+func (sr *SlyftRC) settingsToChange() *Settings {
+	if p, _ := sr.profile(); p != nil {
+		return &p.Settings
+	}
+	return &sr.Settings
+}
+
+// changeSetting applies fn to the config. Credentials are moved along when
+// another credential store is selected.
+func changeSetting(k *configKey, fn func(sr *SlyftRC)) error {
+	var err error
+	if uerr := updateConfig(func(sr *SlyftRC) bool {
+		if strings.HasPrefix(k.Name, "credential-") {
+			err = migrateCredentials(sr, fn)
+			return err == nil
+		}
+		fn(sr)
+		return true
+	}); uerr != nil {
+		return uerr
+	}
+	return err
+}
+
+// configListing is the JSON output of `slyft config list`.
+type configListing struct {
+	Profile  string          `json:"profile"`
+	Settings []configSetting `json:"settings"`
+}
+
+type configSetting struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Source      string `json:"source"`
+	Description string `json:"description"`
+}
+
+func listConfig(cmd *cli.Cmd) {
+	cmd.Action = func() {
+		sr, _ := readConfig()
+		listing := configListing{Profile: sr.profileName()}
+		data := [][]string{
+			[]string{"Key", "Value", "Source", "Description"},
+		}
+		for i := range configKeys {
+			k := &configKeys[i]
+			v, source := lookupSetting(sr, k)
+			listing.Settings = append(listing.Settings, configSetting{k.Name, v, source, k.Desc})
+			data = append(data, []string{k.Name, v, source, k.Desc})
+		}
+		if outputJSON() {
+			printJSON(listing)
+			return
+		}
+		fmt.Printf("Active profile: %s\n\n", sr.profileName())
+		fmt.Fprint(os.Stdout, markdownTable(&data))
+	}
+}
+
+func getConfig(cmd *cli.Cmd) {
+	cmd.Spec = "KEY"
+	name := cmd.StringArg("KEY", "", "Name of the setting")
+
+	cmd.Action = func() {
+		k, err := findConfigKey(*name)
+		if err != nil {
+			fmt.Println(err)
+			cli.Exit(1)
+		}
+		sr, _ := readConfig()
+		v, _ := lookupSetting(sr, k)
+		fmt.Println(v)
+	}
+}
+
+func setConfig(cmd *cli.Cmd) {
+	cmd.Spec = "KEY VALUE"
+	name := cmd.StringArg("KEY", "", "Name of the setting")
+	value := cmd.StringArg("VALUE", "", "New value")
+
+	cmd.Action = func() {
+		k, err := findConfigKey(*name)
+		if err == nil {
+			err = k.set(&Settings{}, *value)
+		}
+		if err != nil {
+			fmt.Println(err)
+			cli.Exit(1)
+		}
+		err = changeSetting(k, func(sr *SlyftRC) {
+			k.set(sr.settingsToChange(), *value)
+		})
+		if err != nil {
+			ReportError("Writing the config", err)
+			cli.Exit(1)
+		}
+		if os.Getenv(k.Env) != "" {
+			fmt.Printf("Note: %s is set and overrides this setting\n", k.Env)
+		}
+	}
+}
+
+func unsetConfig(cmd *cli.Cmd) {
+	cmd.Spec = "KEY"
+	name := cmd.StringArg("KEY", "", "Name of the setting")
+
+	cmd.Action = func() {
+		k, err := findConfigKey(*name)
+		if err != nil {
+			fmt.Println(err)
+			cli.Exit(1)
+		}
+		err = changeSetting(k, func(sr *SlyftRC) {
+			k.unset(sr.settingsToChange())
+		})
+		if err != nil {
+			ReportError("Writing the config", err)
+			cli.Exit(1)
+		}
+	}
+}
+
+// validateConfig checks a config file edited by hand.
+func validateConfig(b []byte) (*SlyftRC, error) {
+	var sr SlyftRC
+	if err := json.Unmarshal(b, &sr); err != nil {
+		return nil, err
+	}
+	if err := validateSettings(&sr.Settings); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(sr.Profiles))
+	for name := range sr.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if sr.Profiles[name] == nil {
+			return nil, fmt.Errorf("Profile %s: must be an object", name)
+		}
+		if err := validateSettings(&sr.Profiles[name].Settings); err != nil {
+			return nil, fmt.Errorf("Profile %s: %s", name, err)
+		}
+	}
+	if sr.CurrentProfile != "" && sr.Profiles[sr.CurrentProfile] == nil {
+		return nil, fmt.Errorf("Unknown CurrentProfile %s", sr.CurrentProfile)
+	}
+	return &sr, nil
+}
+
+func editor() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if e := os.Getenv(env); e != "" {
+			return e
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+func editConfig(cmd *cli.Cmd) {
+	cmd.Action = func() {
+		sr, _ := readConfig()
+		b, _ := json.MarshalIndent(sr, "", "	")
+
+		tmp, err := ioutil.TempFile("", "slyftrc")
+		if err != nil {
+			ReportError("Creating a temporary file", err)
+			cli.Exit(1)
+		}
+		defer os.Remove(tmp.Name())
+		tmp.Write(b)
+		tmp.Close()
+
+		for {
+			args := strings.Fields(editor())
+			c := exec.Command(args[0], append(args[1:], tmp.Name())...)
+			c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+			if err := c.Run(); err != nil {
+				ReportError("Running the editor", err)
+				cli.Exit(1)
+			}
+
+			b, err := ioutil.ReadFile(tmp.Name())
+			if err != nil {
+				ReportError("Reading the edited config", err)
+				cli.Exit(1)
+			}
+			edited, err := validateConfig(b)
+			if err != nil {
+				fmt.Printf("Invalid config: %s\n", err)
+				if askForConfirmation("Edit again?") {
+					continue
+				}
+				fmt.Println("Config not changed")
+				cli.Exit(1)
+			}
+			if err := updateConfig(func(sr *SlyftRC) bool { *sr = *edited; return true }); err != nil {
+				ReportError("Writing the config", err)
+				cli.Exit(1)
+			}
+			return
+		}
+	}
+}
+
+func showConfigPath(cmd *cli.Cmd) {
+	cmd.Action = func() {
+		fmt.Println(defaultConfigFile())
+	}
+}
+
+func RegisterConfigRoutes(config *cli.Cmd) {
+	SetupLogger()
+
+	config.Command("list ls", "List all settings with their values and sources", listConfig)
+	config.Command("get", "Show a setting", getConfig)
+	config.Command("set", "Change a setting of the active profile", setConfig)
+	config.Command("unset", "Reset a setting of the active profile", unsetConfig)
+	config.Command("edit", "Edit the config file with $EDITOR", editConfig)
+	config.Command("path", "Show the location of the config file", showConfigPath)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConfigKeys(t *testing.T) {
+	var s Settings
+	valid := map[string]string{
+		"backend":        "https://staging.example.com/",
+		"output":         "json",
+		"timeout":        "10",
+		"insecure":       "true",
+		"retry-attempts": "1",
+	}
+	for name, v := range valid {
+		k, err := findConfigKey(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := k.set(&s, v); err != nil || k.get(&s) != v {
+			t.Errorf("Must accept %s=%s, got %q (%v)", name, v, k.get(&s), err)
+		}
+	}
+
+	invalid := map[string]string{
+		"backend":        "staging.example.com",
+		"output":         "yaml",
+		"timeout":        "-1",
+		"retry-attempts": "0",
+		"insecure":       "maybe",
+		"ca-file":        "/does/not/exist.pem",
+	}
+	for name, v := range invalid {
+		k, _ := findConfigKey(name)
+		if err := k.set(&s, v); err == nil {
+			t.Errorf("Must reject %s=%s", name, v)
+		}
+	}
+	if _, err := findConfigKey("unknown"); err == nil {
+		t.Error("Must reject unknown keys")
+	}
+	if _, err := validateConfig([]byte(`{"Output": "yaml"}`)); err == nil {
+		t.Error("Must reject invalid config")
+	}
+	if _, err := validateConfig([]byte(`{"CurrentProfile": "staging"}`)); err == nil {
+		t.Error("Must reject unknown current profile")
+	}
+}
+
+func TestSettingsPrecedence(t *testing.T) {
+	defer withTempHome(t)()
+
+	updateConfig(func(sr *SlyftRC) bool {
+		sr.Timeout = seconds(5)
+		sr.Project = "demo"
+		return true
+	})
+	sr, _ := readConfig()
+	k, _ := findConfigKey("timeout")
+	if v, source := lookupSetting(sr, k); v != "5" || source != "config file" {
+		t.Errorf("Expected timeout from config file, got %s from %s", v, source)
+	}
+
+	os.Setenv("SLYFT_TIMEOUT", "7")
+	defer os.Unsetenv("SLYFT_TIMEOUT")
+	if v, _ := lookupSetting(sr, k); v != "7" || *currentSettings().Timeout != 7 {
+		t.Errorf("Environment must override config file, got %s", v)
+	}
+
+	k, _ = findConfigKey("output")
+	if v, source := lookupSetting(sr, k); v != "text" || source != "default" {
+		t.Errorf("Expected default output, got %s from %s", v, source)
+	}
+
+	dir, _ := os.Getwd()
+	defer os.Chdir(dir)
+	os.Chdir(os.Getenv("HOME"))
+	if p, _ := ReadProjectLock(); p != "demo" {
+		t.Errorf("Expected project from config, got %s", p)
+	}
+}
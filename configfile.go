@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// several slyft processes may update the config file at the same time, e.g.
+// when the backend rotates access tokens. Writers serialize on an advisory
+// lock of a file next to the config and replace the config atomically.
+var configLockTimeout = 5 * time.Second
+
+// lockConfig acquires the config lock and returns the function to release
+// it. The lock file itself is kept, removing it would let another process
+// lock a new file while the old one is still locked.
+func lockConfig() (func(), error) {
+	lockFile := defaultConfigFile() + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockFile), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(configLockTimeout)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if locked {
+			return func() {
+				unlockFile(f)
+				f.Close()
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, errors.New("Timed out waiting for lock file " + lockFile)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// migrateConfig moves the config and encrypted credentials of older
+// versions from legacyConfigFile to defaultConfigFile, unless SLYFT_CONFIG
+// is set or there already is a config.
+func migrateConfig() error {
+	legacy, file := legacyConfigFile(), defaultConfigFile()
+	if os.Getenv("SLYFT_CONFIG") != "" || fileExists(legacy) != nil || fileExists(file) == nil {
+		return nil
+	}
+
+	unlock, err := lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if fileExists(file) == nil {
+		// migrated by another process meanwhile
+		return nil
+	}
+
+	// the config goes last, so that an interrupted migration is retried
+	for _, suffix := range []string{".credentials", ""} {
+		if err := moveFile(legacy+suffix, file+suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Moved your config from %s to %s\n", legacy, file)
+	return nil
+}
+
+// moveFile renames from to to, copying it if they are on different file
+// systems. Like all config files, to is readable by the user only.
+func moveFile(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return os.Chmod(to, 0600)
+	}
+	b, err := ioutil.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(to, b); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// writeConfig writes the config to a temporary file and renames it over the
+// config file, so that readers never see a partially written config.
+func writeConfig(sr *SlyftRC) error {
+	newConfig, err := json.MarshalIndent(sr, "", "	")
+	if err != nil {
+		Log.Error("Failure to update config file: " + defaultConfigFile())
+		return err
+	}
+
+	if err := writeFileAtomic(defaultConfigFile(), newConfig); err != nil {
+		Log.Error("Failure to write config file: " + defaultConfigFile())
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic replaces file with b via a temporary file. The file is
+// readable by the user only, as it may contain credentials.
+func writeFileAtomic(file string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	return err
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thingforward/slyft-cli/slyft"
+)
+
+func withTempHome(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "slyft-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{}
+	for _, k := range []string{"HOME", "XDG_CONFIG_HOME", "SLYFT_CONFIG"} {
+		env[k] = os.Getenv(k)
+		os.Unsetenv(k)
+	}
+	os.Setenv("HOME", dir)
+	return func() {
+		for k, v := range env {
+			os.Setenv(k, v)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestConfigLocation(t *testing.T) {
+	defer withTempHome(t)()
+	home := os.Getenv("HOME")
+
+	if f := defaultConfigFile(); f != filepath.Join(home, ".config", "slyft", "config.json") {
+		t.Errorf("Unexpected default config file %s", f)
+	}
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+	if f := defaultConfigFile(); f != filepath.Join(home, "xdg", "slyft", "config.json") {
+		t.Errorf("Must use XDG_CONFIG_HOME, got %s", f)
+	}
+	os.Setenv("SLYFT_CONFIG", filepath.Join(home, "other.json"))
+	if f := defaultConfigFile(); f != filepath.Join(home, "other.json") {
+		t.Errorf("Must use SLYFT_CONFIG, got %s", f)
+	}
+}
+
+func TestMigrateConfig(t *testing.T) {
+	defer withTempHome(t)()
+
+	legacy := legacyConfigFile()
+	ioutil.WriteFile(legacy, []byte(`{"Auth":{"Uid":"foo@bar.boo"}}`), 0644)
+	ioutil.WriteFile(legacy+".credentials", []byte("{}"), 0600)
+	if err := migrateConfig(); err != nil {
+		t.Fatalf("Must migrate config: %v", err)
+	}
+	if sr, err := readConfig(); err != nil || sr.Auth.Uid != "foo@bar.boo" {
+		t.Errorf("Must read migrated config, got %v (%v)", sr, err)
+	}
+	for _, f := range []string{legacy, legacy + ".credentials"} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("Must move %s", f)
+		}
+	}
+	if _, err := os.Stat(defaultConfigFile() + ".credentials"); err != nil {
+		t.Errorf("Must move credentials: %v", err)
+	}
+	if fi, err := os.Stat(defaultConfigFile()); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Migrated config must be readable by the user only, got %v (%v)", fi.Mode(), err)
+	}
+
+	// an existing config is never replaced
+	ioutil.WriteFile(legacy, []byte(`{"Auth":{"Uid":"old@bar.boo"}}`), 0600)
+	migrateConfig()
+	if sr, _ := readConfig(); sr.Auth.Uid != "foo@bar.boo" {
+		t.Errorf("Must keep existing config, got %v", sr.Auth)
+	}
+}
+
+func TestWriteAuthToConfig(t *testing.T) {
+	defer withTempHome(t)()
+
+	sa := &SlyftAuth{AccessToken: "token", Client: "client", Uid: "foo@bar.boo", Expiry: 42}
+	if err := writeAuthToConfig(sa); err != nil {
+		t.Fatalf("Must write config: %v", err)
+	}
+	read, err := readAuthFromConfig()
+	if err != nil || *read != *sa {
+		t.Errorf("Expected %v, got %v (%v)", sa, read, err)
+	}
+	unlock, err := lockConfig()
+	if err != nil {
+		t.Fatalf("Must release config lock: %v", err)
+	}
+	unlock()
+}
+
+func TestUpdateInvalidConfig(t *testing.T) {
+	defer withTempHome(t)()
+
+	broken := []byte(`{"Profiles": {"staging": {}},}`)
+	os.MkdirAll(filepath.Dir(defaultConfigFile()), 0700)
+	ioutil.WriteFile(defaultConfigFile(), broken, 0600)
+	if err := writeAuthToConfig(&SlyftAuth{AccessToken: "token", Client: "client", Uid: "foo@bar.boo"}); err == nil {
+		t.Error("Must not update a config that cannot be parsed")
+	}
+	if b, _ := ioutil.ReadFile(defaultConfigFile()); string(b) != string(broken) {
+		t.Errorf("Must keep the config, got %s", b)
+	}
+}
+
+func TestLockConfig(t *testing.T) {
+	defer withTempHome(t)()
+	defer func(d time.Duration) { configLockTimeout = d }(configLockTimeout)
+	configLockTimeout = 100 * time.Millisecond
+
+	// a lock file left behind by a crashed process does not block
+	os.MkdirAll(filepath.Dir(defaultConfigFile()), 0700)
+	ioutil.WriteFile(defaultConfigFile()+".lock", []byte("12345\n"), 0600)
+	unlock, err := lockConfig()
+	if err != nil {
+		t.Fatalf("Must lock config: %v", err)
+	}
+	if _, err := lockConfig(); err == nil {
+		t.Error("Must not lock config twice")
+	}
+	unlock()
+	unlock, err = lockConfig()
+	if err != nil {
+		t.Fatalf("Must lock released config: %v", err)
+	}
+	unlock()
+}
+
+func TestUpdateAuth(t *testing.T) {
+	defer withTempHome(t)()
+
+	writeAuthToConfig(&SlyftAuth{AccessToken: "t1", Client: "client", Uid: "foo@bar.boo", Expiry: 10})
+	used := &slyft.Auth{AccessToken: "t1", Client: "client", Uid: "foo@bar.boo", Expiry: 10}
+
+	configAuth{}.UpdateAuth(used, &slyft.Auth{AccessToken: "t2", Client: "client", Uid: "foo@bar.boo", Expiry: 20})
+	if sa, _ := readAuthFromConfig(); sa.AccessToken != "t2" {
+		t.Errorf("Must store rotated token, got %v", sa)
+	}
+
+	// a concurrent process that used t1 must not overwrite t2 with older data
+	configAuth{}.UpdateAuth(used, &slyft.Auth{AccessToken: "t3", Client: "client", Uid: "foo@bar.boo", Expiry: 15})
+	if sa, _ := readAuthFromConfig(); sa.AccessToken != "t2" {
+		t.Errorf("Must keep newer token, got %v", sa)
+	}
+
+	// nor resurrect a session after logout
+	deactivateLogin()
+	configAuth{}.UpdateAuth(used, &slyft.Auth{AccessToken: "t4", Client: "client", Uid: "foo@bar.boo", Expiry: 30})
+	if sa, _ := readAuthFromConfig(); sa.GoodForLogin() {
+		t.Errorf("Must not store credentials after logout, got %v", sa)
+	}
+}
+
+func TestAuthUsed(t *testing.T) {
+	defer withTempHome(t)()
+
+	now := time.Unix(1000000, 0)
+	configAuth{}.AuthUsed(nil, now)
+	if sr, _ := readConfig(); sr.LastUsed[defaultProfile] != now.Unix() {
+		t.Errorf("Must store time of last call, got %v", sr.LastUsed)
+	}
+
+	// written at most once per lastUsedInterval
+	configAuth{}.AuthUsed(nil, now.Add(time.Second))
+	if sr, _ := readConfig(); sr.LastUsed[defaultProfile] != now.Unix() {
+		t.Errorf("Must not store time again within %s, got %v", lastUsedInterval, sr.LastUsed)
+	}
+	later := now.Add(lastUsedInterval)
+	configAuth{}.AuthUsed(nil, later)
+	if sr, _ := readConfig(); sr.LastUsed[defaultProfile] != later.Unix() {
+		t.Errorf("Must store time of last call, got %v", sr.LastUsed)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	defer withTempHome(t)()
+	defer func() { timeoutSet = false }()
+
+	if err := setupHTTPClient(); err != nil || httpClient().Timeout != slyft.DefaultTimeout {
+		t.Errorf("Expected default timeout, got %v (%v)", httpClient().Timeout, err)
+	}
+
+	updateConfig(func(sr *SlyftRC) bool { sr.Timeout = seconds(5); return true })
+	if setupHTTPClient(); httpClient().Timeout != 5*time.Second {
+		t.Errorf("Expected timeout from config, got %v", httpClient().Timeout)
+	}
+
+	fTimeout, timeoutSet = new(int), true
+	if setupHTTPClient(); httpClient().Timeout != 0 {
+		t.Errorf("Flag must override config, got %v", httpClient().Timeout)
+	}
+
+	// 0 in the config means no limit, too
+	timeoutSet = false
+	updateConfig(func(sr *SlyftRC) bool { sr.Timeout = seconds(0); return true })
+	if setupHTTPClient(); httpClient().Timeout != 0 {
+		t.Errorf("Expected no timeout from config, got %v", httpClient().Timeout)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	defer withTempHome(t)()
+
+	if p := retryPolicy(); p.Timeout != slyft.DefaultRetryPolicy().Timeout {
+		t.Errorf("Expected default retry timeout, got %v", p.Timeout)
+	}
+	updateConfig(func(sr *SlyftRC) bool { sr.RetryTimeout = seconds(0); return true })
+	if p := retryPolicy(); p.Timeout != 0 {
+		t.Errorf("Expected no retry timeout from config, got %v", p.Timeout)
+	}
+}
+
+func seconds(n int) *int {
+	return &n
+}
+
+func TestProfiles(t *testing.T) {
+	defer withTempHome(t)()
+	defer func() { fProfile = nil }()
+
+	writeAuthToConfig(&SlyftAuth{AccessToken: "t1", Client: "c1", Uid: "foo@bar.boo"})
+	updateConfig(func(sr *SlyftRC) bool {
+		sr.Timeout = seconds(5)
+		sr.Proxy = "http://proxy:3128"
+		sr.Profiles = map[string]*Profile{
+			"staging": {Settings: Settings{Backend: "https://staging.example.com/", Timeout: seconds(10)}},
+		}
+		return true
+	})
+	if backendURL() != slyft.DefaultBaseURL {
+		t.Errorf("Expected production backend for default profile, got %s", backendURL())
+	}
+
+	staging := "staging"
+	fProfile = &staging
+	if sa, _ := readAuthFromConfig(); sa.GoodForLogin() {
+		t.Errorf("Expected no credentials for new profile, got %v", sa)
+	}
+	writeAuthToConfig(&SlyftAuth{AccessToken: "t2", Client: "c2", Uid: "bar@bar.boo"})
+	sr, _ := readConfig()
+	if sr.Auth.AccessToken != "t1" || sr.Profiles["staging"].Auth.AccessToken != "t2" {
+		t.Errorf("Must store credentials per profile, got %v", sr)
+	}
+	if s := sr.settings(); *s.Timeout != 10 || s.Proxy != "http://proxy:3128" {
+		t.Errorf("Expected profile settings on top of default, got %+v", s)
+	}
+	if backendURL() != "https://staging.example.com/" {
+		t.Errorf("Expected staging backend, got %s", backendURL())
+	}
+
+	unknown := "unknown"
+	fProfile = &unknown
+	if checkProfile() == nil {
+		t.Error("Must reject unknown profile")
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thingforward/slyft-cli/slyft"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// CredentialStore keeps the credentials of profiles. The store is chosen
+// with the credential-store setting, see credentialStore.
+type CredentialStore interface {
+	// Get returns the credentials of profile, empty ones if there are none.
+	Get(profile string) (*SlyftAuth, error)
+	Store(profile string, sa *SlyftAuth) error
+	Erase(profile string) error
+}
+
+// credentialStore returns the store selected for profile. A plaintext store
+// keeps the credentials in sr, so callers modifying them must write sr,
+// see updateConfig.
+func (sr *SlyftRC) credentialStore(profile string) (CredentialStore, error) {
+	s := sr.effectiveSettings(profile)
+	switch s.CredentialStore {
+	case "", "plaintext":
+		return plaintextStore{Config: sr}, nil
+	case "file":
+		return encryptedFileStore{File: defaultConfigFile() + ".credentials"}, nil
+	case "helper":
+		if s.CredentialHelper == "" {
+			return nil, errors.New("Credential store helper needs the credential-helper setting")
+		}
+		// like backendURL, for profiles other than the active one
+		backend := s.Backend
+		if backend == "" && profile == sr.profileName() {
+			backend = apiEndpoint
+		}
+		if backend == "" {
+			backend = slyft.DefaultBaseURL
+		}
+		return helperStore{Command: s.CredentialHelper, Backend: backend}, nil
+	}
+	return nil, errors.New("Unknown credential store " + s.CredentialStore)
+}
+
+// plaintextStore keeps the credentials in the config file, which is
+// readable by the user only.
+type plaintextStore struct {
+	Config *SlyftRC
+}
+
+func (s plaintextStore) Get(profile string) (*SlyftAuth, error) {
+	sa := *s.Config.authOf(profile)
+	return &sa, nil
+}
+
+func (s plaintextStore) Store(profile string, sa *SlyftAuth) error {
+	*s.Config.authOf(profile) = *sa
+	return nil
+}
+
+func (s plaintextStore) Erase(profile string) error {
+	return s.Store(profile, &SlyftAuth{})
+}
+
+// parameters of the scrypt key derivation, see golang.org/x/crypto/scrypt
+const (
+	scryptN      = 32768
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// passphrase and key of the encrypted credentials, kept for the lifetime
+// of the process so that rotated tokens can be stored without asking again.
+// Requests run in parallel, e.g. `slyft asset add --parallel`, so they are
+// guarded by cachedKeyLock.
+var cachedPassphrase string
+var cachedKey, cachedSalt []byte
+var cachedKeyLock sync.Mutex
+
+// encryptedFileStore keeps the credentials of all profiles in File,
+// encrypted with AES-GCM and a key derived from a passphrase. The
+// passphrase is taken from SLYFT_PASSPHRASE or asked for.
+type encryptedFileStore struct {
+	File string
+}
+
+type encryptedCredentials struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+func (s encryptedFileStore) Get(profile string) (*SlyftAuth, error) {
+	all, _, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	sa := all[profile]
+	return &sa, nil
+}
+
+func (s encryptedFileStore) Store(profile string, sa *SlyftAuth) error {
+	all, salt, err := s.load()
+	if err != nil {
+		return err
+	}
+	all[profile] = *sa
+	return s.save(all, salt)
+}
+
+func (s encryptedFileStore) Erase(profile string) error {
+	all, salt, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := all[profile]; !ok {
+		return nil
+	}
+	delete(all, profile)
+	return s.save(all, salt)
+}
+
+// load decrypts the credentials of all profiles. If there is no file yet,
+// it returns no credentials and a nil salt.
+func (s encryptedFileStore) load() (map[string]SlyftAuth, []byte, error) {
+	all := map[string]SlyftAuth{}
+	b, err := ioutil.ReadFile(s.File)
+	if os.IsNotExist(err) {
+		return all, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ec encryptedCredentials
+	if err := json.Unmarshal(b, &ec); err != nil {
+		return nil, nil, fmt.Errorf("Invalid credentials file %s: %s", s.File, err)
+	}
+	gcm, err := credentialCipher(ec.Salt, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := gcm.Open(nil, ec.Nonce, ec.Data, nil)
+	if err != nil {
+		cachedKeyLock.Lock()
+		cachedPassphrase, cachedKey = "", nil
+		cachedKeyLock.Unlock()
+		return nil, nil, errors.New("Unable to decrypt " + s.File + ", wrong passphrase?")
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, nil, err
+	}
+	return all, ec.Salt, nil
+}
+
+func (s encryptedFileStore) save(all map[string]SlyftAuth, salt []byte) error {
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	newFile := salt == nil
+	if newFile {
+		salt = make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+	}
+	gcm, err := credentialCipher(salt, newFile)
+	if err != nil {
+		return err
+	}
+	ec := encryptedCredentials{Salt: salt, Nonce: make([]byte, gcm.NonceSize())}
+	if _, err := rand.Read(ec.Nonce); err != nil {
+		return err
+	}
+	ec.Data = gcm.Seal(nil, ec.Nonce, data, nil)
+
+	b, err := json.MarshalIndent(ec, "", "	")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.File, b)
+}
+
+// credentialCipher returns the cipher for the key derived from the
+// passphrase and salt. If confirm is set, a passphrase asked for must be
+// entered twice.
+func credentialCipher(salt []byte, confirm bool) (cipher.AEAD, error) {
+	cachedKeyLock.Lock()
+	defer cachedKeyLock.Unlock()
+	if cachedKey == nil || !bytes.Equal(salt, cachedSalt) {
+		pass, err := credentialPassphrase(confirm)
+		if err != nil {
+			return nil, err
+		}
+		key, err := scrypt.Key([]byte(pass), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+		if err != nil {
+			return nil, err
+		}
+		cachedKey, cachedSalt = key, salt
+	}
+	block, err := aes.NewCipher(cachedKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// credentialPassphrase must be called with cachedKeyLock held.
+func credentialPassphrase(confirm bool) (string, error) {
+	if pass := os.Getenv("SLYFT_PASSPHRASE"); pass != "" {
+		return pass, nil
+	}
+	if cachedPassphrase != "" {
+		return cachedPassphrase, nil
+	}
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("Credentials are encrypted, please set SLYFT_PASSPHRASE")
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase for your slyft credentials: ")
+	pass, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(pass) == 0 {
+		return "", errors.New("Passphrase must not be empty")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		again, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(pass, again) {
+			return "", errors.New("Passphrases do not match")
+		}
+	}
+	cachedPassphrase = string(pass)
+	return cachedPassphrase, nil
+}
+
+// helperStore delegates to an external program, similar to git credential
+// helpers. The program is run as `<Command> get|store|erase` and receives
+// key=value lines on stdin: profile and Backend, and for store the
+// credentials as access_token, client, uid and expiry. For get, it prints
+// the credentials in the same format, or nothing if it has none.
+type helperStore struct {
+	Command string
+	Backend string
+}
+
+func (h helperStore) Get(profile string) (*SlyftAuth, error) {
+	out, err := h.run("get", profile, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var sa SlyftAuth
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "access_token":
+			sa.AccessToken = kv[1]
+		case "client":
+			sa.Client = kv[1]
+		case "uid":
+			sa.Uid = kv[1]
+		case "expiry":
+			sa.Expiry, _ = strconv.ParseInt(kv[1], 10, 64)
+		}
+	}
+	return &sa, nil
+}
+
+func (h helperStore) Store(profile string, sa *SlyftAuth) error {
+	_, err := h.run("store", profile, sa)
+	return err
+}
+
+func (h helperStore) Erase(profile string) error {
+	_, err := h.run("erase", profile, nil)
+	return err
+}
+
+func (h helperStore) run(action, profile string, sa *SlyftAuth) ([]byte, error) {
+	var in bytes.Buffer
+	fmt.Fprintf(&in, "profile=%s\nbackend=%s\n", profile, h.Backend)
+	if sa != nil {
+		fmt.Fprintf(&in, "access_token=%s\nclient=%s\nuid=%s\nexpiry=%d\n", sa.AccessToken, sa.Client, sa.Uid, sa.Expiry)
+	}
+	in.WriteString("\n")
+
+	args, err := splitCommand(h.Command)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(args[0], append(args[1:], action)...)
+	cmd.Stdin = &in
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Credential helper %s %s failed: %s", h.Command, action, err)
+	}
+	return out, nil
+}
+
+// splitCommand splits the command line s into the program and its
+// arguments at spaces, except within single or double quotes, so that e.g.
+// a program path containing spaces can be quoted. Backslashes are kept as
+// they are, for Windows paths.
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("Unterminated quote in command " + s)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("Empty credential helper command")
+	}
+	return args, nil
+}
+
+func validateCommand(s string) error {
+	_, err := splitCommand(s)
+	return err
+}
+
+// migrateCredentials applies change, which selects another credential
+// store, to sr and moves the credentials of the active profile to the new
+// store. It is called from updateConfig, so that no login in between is
+// lost; if it fails, sr must not be written.
+func migrateCredentials(sr *SlyftRC, change func(sr *SlyftRC)) error {
+	profile := sr.profileName()
+	from, err := sr.credentialStore(profile)
+	var sa *SlyftAuth
+	if err == nil {
+		sa, err = from.Get(profile)
+	}
+	change(sr)
+	to, toErr := sr.credentialStore(profile)
+	if toErr != nil {
+		return toErr
+	}
+	if err != nil || !sa.GoodForLogin() || to == from {
+		return nil
+	}
+	if err := to.Store(profile, sa); err != nil {
+		return err
+	}
+	if err := from.Erase(profile); err != nil {
+		// the credentials are in the new store already
+		Log.Warningf("Unable to remove your credentials from the previous store: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPlaintextStore(t *testing.T) {
+	defer withTempHome(t)()
+
+	writeAuthToConfig(&SlyftAuth{AccessToken: "token", Client: "client", Uid: "foo@bar.boo"})
+	fi, err := os.Stat(defaultConfigFile())
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Config must be readable by the user only, got %v (%v)", fi.Mode(), err)
+	}
+}
+
+func TestEncryptedFileStore(t *testing.T) {
+	defer withTempHome(t)()
+	defer func() { cachedPassphrase, cachedKey, cachedSalt = "", nil, nil }()
+
+	os.Setenv("SLYFT_PASSPHRASE", "correct horse")
+	defer os.Unsetenv("SLYFT_PASSPHRASE")
+	sa := &SlyftAuth{AccessToken: "secret-token", Client: "client", Uid: "foo@bar.boo", Expiry: 42}
+	writeAuthToConfig(sa)
+
+	k, _ := findConfigKey("credential-store")
+	if err := changeSetting(k, func(sr *SlyftRC) { sr.CredentialStore = "file" }); err != nil {
+		t.Fatalf("Must migrate credentials: %v", err)
+	}
+	if read, err := readAuthFromConfig(); err != nil || *read != *sa {
+		t.Errorf("Expected %v, got %v (%v)", sa, read, err)
+	}
+	b, _ := ioutil.ReadFile(defaultConfigFile())
+	if strings.Contains(string(b), sa.AccessToken) {
+		t.Errorf("Must remove plaintext credentials:\n%s", b)
+	}
+	b, _ = ioutil.ReadFile(defaultConfigFile() + ".credentials")
+	if len(b) == 0 || strings.Contains(string(b), sa.AccessToken) {
+		t.Errorf("Must store encrypted credentials:\n%s", b)
+	}
+
+	// parallel requests share the cached key
+	cachedKey = nil
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if read, err := readAuthFromConfig(); err != nil || *read != *sa {
+				t.Errorf("Expected %v, got %v (%v)", sa, read, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cachedKey = nil
+	os.Setenv("SLYFT_PASSPHRASE", "wrong")
+	if _, err := readAuthFromConfig(); err == nil {
+		t.Error("Must reject wrong passphrase")
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	for s, want := range map[string][]string{
+		"helper get":                     {"helper", "get"},
+		`"/my dir/helper" --flag`:        {"/my dir/helper", "--flag"},
+		`'/my dir/helper'  "a 'b'" c''d`: {"/my dir/helper", "a 'b'", "cd"},
+		`C:\Program\helper.exe ""`:       {`C:\Program\helper.exe`, ""},
+	} {
+		if got, err := splitCommand(s); err != nil || strings.Join(got, "|") != strings.Join(want, "|") || len(got) != len(want) {
+			t.Errorf("%s: expected %q, got %q (%v)", s, want, got, err)
+		}
+	}
+	for _, s := range []string{"", "  ", `"helper`} {
+		if _, err := splitCommand(s); err == nil {
+			t.Errorf("Must reject %q", s)
+		}
+	}
+}
+
+func TestHelperStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	defer withTempHome(t)()
+
+	// stores the last input, prints it on get
+	helper := filepath.Join(os.Getenv("HOME"), "my helper.sh")
+	script := "#!/bin/sh\nstate=\"$HOME/helper.state\"\ncase \"$1\" in\n" +
+		"get) test -f \"$state\" && cat \"$state\" ;;\nstore) cat > \"$state\" ;;\nerase) rm -f \"$state\" ;;\nesac\nexit 0\n"
+	if err := ioutil.WriteFile(helper, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	updateConfig(func(sr *SlyftRC) bool {
+		sr.CredentialStore, sr.CredentialHelper = "helper", `"`+helper+`"`
+		return true
+	})
+
+	sa := &SlyftAuth{AccessToken: "token", Client: "client", Uid: "foo@bar.boo", Expiry: 42}
+	if err := writeAuthToConfig(sa); err != nil {
+		t.Fatalf("Must store credentials: %v", err)
+	}
+	if read, err := readAuthFromConfig(); err != nil || *read != *sa {
+		t.Errorf("Expected %v, got %v (%v)", sa, read, err)
+	}
+	deactivateLogin()
+	if read, err := readAuthFromConfig(); err != nil || read.GoodForLogin() {
+		t.Errorf("Expected erased credentials, got %v (%v)", read, err)
+	}
+
+	// other profiles are passed with their own backend
+	sr := &SlyftRC{Settings: Settings{CredentialStore: "helper", CredentialHelper: `"` + helper + `"`}}
+	sr.Profiles = map[string]*Profile{"staging": {Settings: Settings{Backend: "https://staging.slyft.io/"}}}
+	store, err := sr.credentialStore("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Store("staging", sa)
+	b, _ := ioutil.ReadFile(filepath.Join(os.Getenv("HOME"), "helper.state"))
+	if !strings.Contains(string(b), "profile=staging\nbackend=https://staging.slyft.io/\n") {
+		t.Errorf("Must pass profile and its backend, got:\n%s", b)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+	"github.com/thingforward/slyft-cli/mockserver"
+)
+
+func runMockServer(cmd *cli.Cmd) {
+	cmd.Spec = "[--listen] [--user...] [--job-duration] [--rotate-tokens] [--terms] [--require-confirmation] [--lock-after]"
+	listen := cmd.StringOpt("listen l", "localhost:3000", "Address to listen on")
+	users := cmd.StringsOpt("user u", nil, "Pre-registered account as EMAIL:PASSWORD (repeatable)")
+	jobDuration := cmd.IntOpt("job-duration", 5, "Seconds a job takes to be processed")
+	rotate := cmd.BoolOpt("rotate-tokens", false, "Issue a new access token with every response")
+	terms := cmd.StringOpt("terms", "", "File with the Terms and Conditions to serve")
+	confirmation := cmd.BoolOpt("require-confirmation", false, "Require new accounts to be confirmed by email")
+	lockAfter := cmd.IntOpt("lock-after", 0, "Lock accounts after this many failed logins (0: never)")
+
+	cmd.Action = func() {
+		srv := mockserver.New()
+		srv.JobDuration = time.Duration(*jobDuration) * time.Second
+		srv.RotateTokens = *rotate
+		srv.RequireConfirmation = *confirmation
+		srv.LockAfter = *lockAfter
+		srv.Mail = func(to, subject, body string) {
+			fmt.Printf("Email to %s: %s\n  %s\n", to, subject, body)
+		}
+		if *terms != "" {
+			b, err := ioutil.ReadFile(*terms)
+			if err != nil {
+				ReportError("Reading the terms", err)
+				cli.Exit(1)
+			}
+			srv.Terms = string(b)
+		}
+		for _, u := range *users {
+			parts := strings.SplitN(u, ":", 2)
+			if len(parts) != 2 || !validateEmail(parts[0]) {
+				fmt.Printf("Invalid --user %s, expected EMAIL:PASSWORD\n", u)
+				cli.Exit(1)
+			}
+			srv.AddUser(parts[0], parts[1])
+		}
+
+		fmt.Printf("Mock backend listening on http://%s/ - all data is kept in memory.\n", *listen)
+		fmt.Printf("To use it, set SLYFTBACKEND=http://%s/\n", *listen)
+		if err := http.ListenAndServe(*listen, srv); err != nil {
+			ReportError("Starting the mock backend", err)
+			cli.Exit(1)
+		}
+	}
+}
+
+func RegisterDevRoutes(dev *cli.Cmd) {
+	SetupLogger()
+
+	dev.Command("mock-server", "Run an in-memory mock backend for testing", runMockServer)
+}
@@ -27,6 +27,17 @@ if (platform === "win32") {
 //default task (`gulp`) triggers build
 gulp.task('default', ['build']);
 
+//build metadata shown by `slyft version`
+function ldflags() {
+  var commit = require('child_process').execSync('git rev-parse --short HEAD').toString().trim();
+  // public key of the release maintainers, see "Signing releases" in README.md
+  var key = process.env.SLYFT_SIGNING_PUBLIC_KEY || '';
+  if (key === '') {
+    console.log('WARNING: SLYFT_SIGNING_PUBLIC_KEY is not set, the build cannot verify updates');
+  }
+  return '-ldflags "-X main.COMMIT=' + commit + ' -X main.BUILD_DATE=' + new Date().toISOString() + ' -X main.signingPublicKey=' + key + '"';
+}
+
 gulp.task('build', function(callback) {
   runSequence(
       'clean-bin-dist',
@@ -52,7 +63,7 @@ gulp.task('go-get', function(callback) {
 
 //build but don't install - the end product lives in `dist`
 gulp.task('go-build', function(callback) {
-  exec('go build -o bin/slyft'+execsuffix+' .', function(err, stdout, stderr) {
+  exec('go build '+ldflags()+' -o bin/slyft'+execsuffix+' .', function(err, stdout, stderr) {
     console.log(stdout);
     console.log(stderr);
     callback(err);
@@ -145,7 +156,7 @@ gulp.task('go-build-win32', function(callback) {
 	platform = "win32"
 	arch = "386"
 	execsuffix = ".exe"
-  exec('GOOS=windows GOARCH=386 go build -o bin/slyft'+execsuffix+' .', function(err, stdout, stderr) {
+  exec('GOOS=windows GOARCH=386 go build '+ldflags()+' -o bin/slyft'+execsuffix+' .', function(err, stdout, stderr) {
     console.log(stdout);
     console.log(stderr);
     callback(err);
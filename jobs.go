@@ -1,39 +1,25 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"strings"
 	"time"
 
 	cli "github.com/jawher/mow.cli"
+	"github.com/thingforward/slyft-cli/slyft"
 )
 
-type Job struct {
-	ID          int        `json:"id"`
-	Kind        string     `json:"kind"`
-	Status      string     `json:"status"`
-	Results     JobResults `json:"results"`
-	ProjectId   int        `json:"project_id"`
-	ProjectName string     `json:"project_name"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-}
-
-type JobResults struct {
-	ResultMessage string   `json:"resultMessage"`
-	ResultStatus  int      `json:"resultStatus"`
-	ResultAssets  []string `json:"resultAssets"`
-	ResultDetails []string `json:"resultDetails"`
-}
-
-func (j *Job) Display() { // String?
+func displayJob(j *slyft.Job) {
 	if j == nil {
 		return
 	}
+	if outputJSON() {
+		printJSON(j)
+		return
+	}
 
 	data := [][]string{
 		[]string{"Key", "Value"},
@@ -60,14 +46,19 @@ func (j *Job) Display() { // String?
 		markdownTable(&data))
 }
 
-func DisplayJobs(jobs []Job) {
+func DisplayJobs(jobs []slyft.Job) {
+	if outputJSON() {
+		printJSON(jobs)
+		return
+	}
+
 	if len(jobs) == 0 {
 		fmt.Println("No jobs found")
 		return
 	}
 
 	if len(jobs) == 1 {
-		jobs[0].Display()
+		displayJob(&jobs[0])
 		return
 	}
 
@@ -80,30 +71,16 @@ func DisplayJobs(jobs []Job) {
 	fmt.Fprint(os.Stdout, markdownTable(&data))
 }
 
-func extractJobsFromBody(body []byte) ([]Job, error) {
-	jobs := make([]Job, 0)
-	if err := json.Unmarshal(body, &jobs); err != nil {
-		return nil, err
-	}
-	return jobs, nil
-}
-
-func extractJobFromBody(body []byte) ([]Job, error) {
-	a := &Job{}
-	if err := json.Unmarshal(body, &a); err != nil {
-		return nil, err
+// chooseJob lists the jobs of project p (or of all projects if p is nil)
+// and lets the user pick one of them.
+func chooseJob(p *slyft.Project, askUser bool, message string) (*slyft.Job, error) {
+	var jobs []slyft.Job
+	var err error
+	if p == nil {
+		jobs, err = API().Jobs.ListAll(requestContext())
+	} else {
+		jobs, err = API().Jobs.List(requestContext(), p.ID)
 	}
-	return []Job{*a}, nil
-}
-
-func chooseJob(endpoint string, askUser bool, message string) (*Job, error) {
-	resp, err := Do(endpoint, "GET", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	jobs, err := extractJobFromResponse(resp, http.StatusOK, true)
-
 	if err != nil {
 		return nil, err
 	}
@@ -127,59 +104,33 @@ func chooseJob(endpoint string, askUser bool, message string) (*Job, error) {
 		return nil, err
 	}
 
-	if choice > len(jobs) {
+	if choice < 1 || choice > len(jobs) {
 		return nil, errors.New("Plese choose a number from the first column")
 	}
 
 	return &jobs[choice-1], nil
 }
 
-type JobParam struct {
-	Job Job `json:"job"`
-}
-
-func creatJobParam(kind string, p *Project) *JobParam {
-	return &JobParam{
-		Job{
-			Kind:      kind,
-			ProjectId: p.ID,
-		},
-	}
-}
-
-func postNewJob(kind, name string) *Job {
+func postNewJob(kind, name string) *slyft.Job {
 	p, err := chooseProject(name, fmt.Sprintf("%s project: ", kind))
 	if err != nil {
 		ReportError("Choosing a project", err)
 		return nil
 	}
 
-	resp, err := Do(p.JobsUrl(), "POST", creatJobParam(kind, p))
+	j, err := API().Jobs.Create(requestContext(), p.ID, kind)
 	if err != nil {
-		ReportError("Contacting the server", err)
+		ReportError("Creating job", err)
 		return nil
 	}
 
-	defer resp.Body.Close()
-	jobs, err := extractJobFromResponse(resp, http.StatusCreated, false)
-	if err != nil {
-		ReportError("Error creating job:", err)
-		return nil
+	Log.Debugf("job=%#v", j)
+	if j.Results.ResultStatus == 0 {
+		fmt.Printf("Job %d is started, use `slyft project status` to view status details\n", j.ID)
+	} else {
+		fmt.Printf("Job %d is completed, use `slyft project status` to view status details\n", j.ID)
 	}
-
-	Log.Debugf("jobs=%#v", jobs)
-	if len(jobs) == 1 {
-		j := jobs[0]
-		if j.Results.ResultStatus == 0 {
-			fmt.Printf("Job %d is started, use `slyft project status` to view status details\n", j.ID)
-		} else {
-			fmt.Printf("Job %d is completed, use `slyft project status` to view status details\n", j.ID)
-		}
-		return &j
-	}
-
-	Log.Errorf("Error, creating a new job returned wrong job data")
-	return nil
+	return j
 }
 
 func jobStatusProject(cmd *cli.Cmd) {
@@ -193,7 +144,7 @@ func jobStatusProject(cmd *cli.Cmd) {
 			*name, _ = ReadProjectLock()
 		}
 		if *all || *name == "" {
-			_, err := chooseJob("/v1/jobs", false, "")
+			_, err := chooseJob(nil, false, "")
 			ReportError("Choosing the job", err)
 		}
 
@@ -203,40 +154,31 @@ func jobStatusProject(cmd *cli.Cmd) {
 			ReportError("Choosing the project", err)
 			return
 		}
-		job, err := chooseJob(p.JobsUrl(), true, "Select a job id to show more details: ")
+		job, err := chooseJob(p, true, "Select a job id to show more details: ")
 		if err != nil {
 			ReportError("Selecting the job", err)
 			return
 		}
-		job.Display()
+		displayJob(job)
 	}
 }
 
-func waitForJobCompletion(job *Job, wait int) bool {
+func waitForJobCompletion(job *slyft.Job, wait int) bool {
 	fmt.Printf("Waiting (max. %d seconds) for job completion.", wait)
-	for wait > 0 {
-		wait -= 5
-		time.Sleep(5 * time.Second)
-		fmt.Print(".")
-
-		resp, err := Do(job.EndPoint(), "GET", nil)
-		if err != nil {
-			return false
-		}
-		defer resp.Body.Close()
-		jobs, err := extractJobFromResponse(resp, http.StatusOK, false)
-		Log.Debugf("jobs=%#v", jobs)
-		//Log.Debugf("#jobs=%d", len(jobs))
-		//Log.Debugf("err=%#v", err)
-
-		if err == nil && jobs != nil && len(jobs) == 1 {
-			Log.Debugf("status=%s", jobs[0].Status)
-			if jobs[0].Status == "processed" {
-				jobs[0].Display()
-				return true
-			}
-		}
+	ctx, cancel := context.WithTimeout(requestContext(), time.Duration(wait)*time.Second)
+	defer cancel()
 
+	j, err := API().Jobs.Wait(ctx, job, 5*time.Second, func(j *slyft.Job) {
+		fmt.Print(".")
+		Log.Debugf("status=%s", j.Status)
+	})
+	if err == nil {
+		displayJob(j)
+		return true
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		ReportError("Waiting for job completion", err)
+		return false
 	}
 	// if we get here, job did not finish in time. Say so.
 	fmt.Printf("Job %d did not complete in time. Please check manually using `slyft project status`", job.ID)
@@ -269,12 +211,8 @@ func validateProject(cmd *cli.Cmd) {
 
 	cmd.Action = func() {
 		job := postNewJob("validate", strings.TrimSpace(*name))
-		if job != nil && wait != nil && *wait > 0{
+		if job != nil && wait != nil && *wait > 0 {
 			waitForJobCompletion(job, *wait)
 		}
 	}
 }
-
-func (job *Job) EndPoint() string {
-	return fmt.Sprintf("/v1/projects/%d/jobs/%d", job.ProjectId, job.ID)
-}
@@ -17,17 +17,19 @@ package main
 
 import (
 	"fmt"
-	"net/http"
 	"os"
 	"time"
 
 	"github.com/jawher/mow.cli"
 	"github.com/op/go-logging"
+	"github.com/thingforward/slyft-cli/slyft"
 )
 
 var VERSION = "0.3.1"
 
-var BackendBaseUrl = os.Getenv("SLYFTBACKEND")
+// set at build time with -ldflags "-X main.COMMIT=... -X main.BUILD_DATE=...",
+// see gulpfile.js and buildInfo
+var COMMIT, BUILD_DATE string
 
 var Log = logging.MustGetLogger("ibtlogger")
 var format_dbg = logging.MustStringFormatter(
@@ -38,6 +40,35 @@ var format = logging.MustStringFormatter(
 )
 var fDebug *bool
 
+// set up by the update check in setupBackend, waits for it to finish
+var waitForUpdateCheck = func() {}
+
+// withBackend is for commands that talk to the backend: setupBackend runs
+// before them. Local commands like `slyft config` do not wait for the
+// network, and work even if this version is refused by the update check.
+func withBackend(init cli.CmdInitializer) cli.CmdInitializer {
+	return func(cmd *cli.Cmd) {
+		cmd.Before = setupBackend
+		init(cmd)
+	}
+}
+
+// setupBackend checks for updates and negotiates the API version.
+func setupBackend() {
+	if !updateCheckDisabled() {
+		wait, err := UpdateCheck(VERSION)
+		if err != nil {
+			Log.Error(err)
+			cli.Exit(1)
+		}
+		waitForUpdateCheck = wait
+	}
+	if err := negotiateAPI(); err != nil {
+		Log.Error(err)
+		cli.Exit(1)
+	}
+}
+
 func getLogFormat() logging.Formatter {
 	// if debug, use timestamps to correlate with server actions
 	if os.Getenv("DEBUGLEVEL") == "DEBUG" {
@@ -62,16 +93,7 @@ func SetupLogger() {
 }
 
 func init() {
-	// https://www.reddit.com/r/golang/comments/45mzie/dont_use_gos_default_http_client/
-	http.DefaultClient.Timeout = 10 * time.Second
-
 	SetupLogger()
-
-	// If Environment variable SLYFTBACKEND is present, take it. Must be a full URL
-	if BackendBaseUrl == "" {
-		// If not, set standard production backend
-		BackendBaseUrl = "https://api.slyft.io/"
-	}
 }
 
 func showBanner() {
@@ -87,14 +109,17 @@ func showBanner() {
 
 func showInfo(cmd *cli.Cmd) {
 	cmd.Action = func() {
+		if outputJSON() {
+			printJSON(currentBuildInfo(true))
+			return
+		}
 		showBanner()
 		fmt.Printf(`
 slyft, slyft.io is (C)opright 2017 Digital Incubation and Growth GmbH
 info@slyft.io
 `)
-		fmt.Printf("Version %s", VERSION)
+		displayBuildInfo(currentBuildInfo(true))
 		fmt.Printf(`
-
 Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
 You may obtain a copy of the License at
@@ -123,22 +148,103 @@ func main() {
 	if len(os.Args) <= 1 {
 		showBanner()
 	}
-	err := UpdateCheck(VERSION)
-	if err != nil {
-		Log.Error(err)
-		return
-	}
-
 	app := cli.App("slyft", "")
 
 	fDebug = app.BoolOpt("debug d", false, "Show debug output")
+	fTrace = app.BoolOpt("trace", false, "Print every request with timings to stderr (credentials redacted)")
+	// https://www.reddit.com/r/golang/comments/45mzie/dont_use_gos_default_http_client/
+	fTimeout = app.Int(cli.IntOpt{
+		Name:      "timeout",
+		Value:     int(slyft.DefaultTimeout / time.Second),
+		Desc:      "Max. number of seconds for a single request (0 = no limit)",
+		SetByUser: &timeoutSet,
+	})
+	fRetryAttempts = app.Int(cli.IntOpt{
+		Name:      "retry-attempts",
+		Value:     slyft.DefaultRetryPolicy().MaxAttempts,
+		Desc:      "Number of attempts for idempotent requests on transient failures (1 disables retries)",
+		SetByUser: &retryAttemptsSet,
+	})
+	fRetryTimeout = app.Int(cli.IntOpt{
+		Name:      "retry-timeout",
+		Value:     int(slyft.DefaultRetryPolicy().Timeout / time.Second),
+		Desc:      "Max. number of seconds spent on retrying a request (0 = no limit)",
+		SetByUser: &retryTimeoutSet,
+	})
+	fCAFile = app.String(cli.StringOpt{
+		Name:   "ca-file",
+		Desc:   "PEM bundle of additional CAs to trust for the backend connection",
+		EnvVar: "SLYFT_CA_FILE",
+	})
+	fClientCert = app.String(cli.StringOpt{
+		Name:   "client-cert",
+		Desc:   "PEM client certificate for mutual TLS",
+		EnvVar: "SLYFT_CLIENT_CERT",
+	})
+	fClientKey = app.String(cli.StringOpt{
+		Name:   "client-key",
+		Desc:   "PEM key of the client certificate",
+		EnvVar: "SLYFT_CLIENT_KEY",
+	})
+	fProxy = app.String(cli.StringOpt{
+		Name:   "proxy",
+		Desc:   "URL of the HTTP(S) proxy to use (default: from HTTPS_PROXY/HTTP_PROXY)",
+		EnvVar: "SLYFT_PROXY",
+	})
+	fInsecure = app.Bool(cli.BoolOpt{
+		Name:   "insecure",
+		Desc:   "Do not verify TLS certificates. DANGEROUS, for testing only",
+		EnvVar: "SLYFT_INSECURE",
+	})
+	fProfile = app.String(cli.StringOpt{
+		Name:   "profile",
+		Desc:   "Name of the profile to use (see `slyft profile list`)",
+		EnvVar: "SLYFT_PROFILE",
+	})
+	fOutput = app.StringOpt("output o", "", "Output format: text or json (default: from config, else text)")
+	fNoUpdateCheck = app.Bool(cli.BoolOpt{
+		Name:   "no-update-check",
+		Desc:   "Do not check for a new version",
+		EnvVar: "SLYFT_NO_UPDATE_CHECK",
+	})
+	fRecord = app.StringOpt("record", "", "Record all API traffic (credentials redacted) to the given cassette file")
+	fReplay = app.StringOpt("replay", "", "Serve API responses from the given cassette file instead of the network")
 
 	app.Version("v version", VERSION)
 
-	app.Command("user u", "User/Account management", RegisterUserRoutes)
-	app.Command("project p", "Project management", RegisterProjectRoutes)
-	app.Command("asset a", "Asset management", RegisterAssetRoutes)
+	app.Before = func() {
+		if err := migrateConfig(); err != nil {
+			ReportError("Moving the config file", err)
+			cli.Exit(1)
+		}
+		if err := checkProfile(); err != nil {
+			fmt.Println(err)
+			cli.Exit(1)
+		}
+		if err := setupOutput(); err != nil {
+			fmt.Println(err)
+			cli.Exit(1)
+		}
+		if err := setupHTTPClient(); err != nil {
+			ReportError("Setting up the backend connection", err)
+			cli.Exit(1)
+		}
+	}
+
+	app.Command("user u", "User/Account management", withBackend(RegisterUserRoutes))
+	app.Command("project p", "Project management", withBackend(RegisterProjectRoutes))
+	app.Command("asset a", "Asset management", withBackend(RegisterAssetRoutes))
+	app.Command("profile", "Profile management", RegisterProfileRoutes)
+	app.Command("config", "Client settings", RegisterConfigRoutes)
+	app.Command("dev", "Developer tools", RegisterDevRoutes)
 	app.Command("info", "Show program info", showInfo)
+	app.Command("version", "Show version and build information", showVersion)
+	app.Command("self-update", "Update slyft to the latest or a given version", selfUpdate)
 
+	handleSignals()
 	app.Run(os.Args)
+	waitForUpdateCheck()
+	if interrupted() {
+		os.Exit(exitInterrupted)
+	}
 }
@@ -0,0 +1,801 @@
+// Package mockserver implements an in-memory Slyft backend for tests and
+// local development. It serves the endpoints used by the slyft client with
+// devise_token_auth style authentication and simulated job progression.
+//
+//	srv := mockserver.New()
+//	srv.AddUser("foo@bar.boo", "secret")
+//	http.ListenAndServe("localhost:3000", srv)
+package mockserver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const termsText = `Slyft mock backend - Terms and Conditions
+
+This server keeps all data in memory. Everything is lost when it stops.
+`
+
+type user struct {
+	ID       int
+	Email    string
+	Password string
+	// client id -> access token
+	Tokens map[string]string
+
+	Confirmed         bool
+	ConfirmationToken string
+	FailedAttempts    int
+	// set while the account is locked
+	UnlockToken string
+}
+
+type project struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Details   string    `json:"details"`
+	Settings  string    `json:"settings"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type asset struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	ProjectId   int       `json:"project_id"`
+	ProjectName string    `json:"project_name"`
+	Origin      string    `json:"origin"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	content     []byte
+}
+
+type jobResults struct {
+	ResultMessage string   `json:"resultMessage"`
+	ResultStatus  int      `json:"resultStatus"`
+	ResultAssets  []string `json:"resultAssets"`
+	ResultDetails []string `json:"resultDetails"`
+}
+
+type job struct {
+	ID          int        `json:"id"`
+	Kind        string     `json:"kind"`
+	Status      string     `json:"status"`
+	Results     jobResults `json:"results"`
+	ProjectId   int        `json:"project_id"`
+	ProjectName string     `json:"project_name"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Server is an in-memory Slyft backend. It implements http.Handler.
+type Server struct {
+	// JobDuration is the time a job takes from creation to "processed".
+	JobDuration time.Duration
+	// TokenLifetime is the validity of issued access tokens.
+	TokenLifetime time.Duration
+	// RotateTokens makes the server issue a new access token with every
+	// authenticated response, like devise_token_auth does by default.
+	RotateTokens bool
+	// Terms is the text of the Terms and Conditions. Each text is served
+	// under its own URL, like new versions of the real terms.
+	Terms string
+	// RequireConfirmation makes registered accounts unusable until they are
+	// confirmed with the link sent by email.
+	RequireConfirmation bool
+	// LockAfter locks an account after this many failed sign-ins in a row
+	// (0: never). It is unlocked with the link sent by email.
+	LockAfter int
+	// Mail is called for every email the server sends, e.g. to print it.
+	Mail func(to, subject, body string)
+
+	mu       sync.Mutex
+	nextID   int
+	users    map[string]*user
+	projects map[int]*project
+	assets   map[int]*asset
+	jobs     map[int]*job
+}
+
+// New returns an empty mock backend.
+func New() *Server {
+	return &Server{
+		JobDuration:   5 * time.Second,
+		TokenLifetime: 14 * 24 * time.Hour,
+		Terms:         termsText,
+		users:         map[string]*user{},
+		projects:      map[int]*project{},
+		assets:        map[int]*asset{},
+		jobs:          map[int]*job{},
+	}
+}
+
+// AddUser registers a confirmed user account.
+func (s *Server) AddUser(email, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addUser(email, password)
+}
+
+func (s *Server) addUser(email, password string) *user {
+	u := &user{ID: s.id(), Email: email, Password: password, Tokens: map[string]string{}, Confirmed: true}
+	s.users[email] = u
+	return u
+}
+
+// termsVersion identifies the current text of the terms.
+func (s *Server) termsVersion() string {
+	sum := sha256.Sum256([]byte(s.Terms))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *Server) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "auth" && r.Method == "POST":
+		s.register(w, r, body)
+	case path == "auth/sign_in" && r.Method == "POST":
+		s.signIn(w, r, body)
+	case path == "auth/password" && r.Method == "POST":
+		s.requestPasswordReset(w, body)
+	case path == "auth/confirmation" && r.Method == "POST":
+		s.resendConfirmation(w, r, body)
+	case path == "auth/confirmation" && r.Method == "GET":
+		s.confirm(w, r.URL.Query().Get("confirmation_token"))
+	case path == "auth/unlock" && r.Method == "POST":
+		s.resendUnlock(w, r, body)
+	case path == "auth/unlock" && r.Method == "GET":
+		s.unlock(w, r.URL.Query().Get("unlock_token"))
+	case path == "version" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"version":     "mock",
+			"api_version": map[string]int{"min": 1, "max": 1},
+		})
+	case path == "terms" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, map[string]string{
+			"url":        "http://" + r.Host + "/terms/" + s.termsVersion(),
+			"started_at": "2017-01-01T00:00:00Z",
+		})
+	case path == "terms/"+s.termsVersion() && r.Method == "GET":
+		w.Write([]byte(s.Terms))
+	case parts[0] == "auth" || parts[0] == "v1":
+		u := s.authenticate(w, r)
+		if u == nil {
+			writeErrors(w, http.StatusUnauthorized, "You need to sign in or sign up before continuing.")
+			return
+		}
+		s.serveAuthenticated(w, r, u, parts, body)
+	default:
+		writeErrors(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *Server) serveAuthenticated(w http.ResponseWriter, r *http.Request, u *user, parts []string, body []byte) {
+	path := strings.Join(parts, "/")
+	switch {
+	case path == "auth/sign_out" && r.Method == "DELETE":
+		delete(u.Tokens, r.Header.Get("client"))
+		w.Header().Del("access-token")
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+	case path == "auth/validate_token" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": userData(u)})
+	case path == "auth/password" && r.Method == "PUT":
+		s.changePassword(w, u, body)
+	case path == "auth" && r.Method == "DELETE":
+		s.deleteUser(u)
+		w.Header().Del("access-token")
+		writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	case path == "v1/projects" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, s.userProjects(u, ""))
+	case path == "v1/projects" && r.Method == "POST":
+		s.createProject(w, u, body)
+	case path == "v1/projects/search" && r.Method == "GET":
+		var p struct {
+			SearchString string `json:"search_string"`
+		}
+		json.Unmarshal(body, &p)
+		writeJSON(w, http.StatusOK, s.userProjects(u, p.SearchString))
+	case path == "v1/assets" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, s.userAssets(u, 0))
+	case path == "v1/jobs" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, s.userJobs(u, 0))
+	case len(parts) >= 3 && parts[0] == "v1" && parts[1] == "projects":
+		p := s.userProject(u, parts[2])
+		if p == nil {
+			writeErrors(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		s.serveProject(w, r, u, p, parts[3:], body)
+	default:
+		writeErrors(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *Server) serveProject(w http.ResponseWriter, r *http.Request, u *user, p *project, parts []string, body []byte) {
+	sub := strings.Join(parts, "/")
+	switch {
+	case sub == "" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, p)
+	case sub == "" && r.Method == "PUT":
+		var param struct {
+			Project project `json:"project"`
+		}
+		json.Unmarshal(body, &param)
+		if param.Project.Name != "" {
+			p.Name = param.Project.Name
+		}
+		if param.Project.Details != "" {
+			p.Details = param.Project.Details
+		}
+		if param.Project.Settings != "" {
+			p.Settings = param.Project.Settings
+		}
+		p.UpdatedAt = time.Now().UTC()
+		w.WriteHeader(http.StatusNoContent)
+	case sub == "" && r.Method == "DELETE":
+		s.deleteProject(p)
+		w.WriteHeader(http.StatusNoContent)
+	case sub == "assets" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, s.userAssets(u, p.ID))
+	case sub == "assets" && r.Method == "POST":
+		s.createAsset(w, p, body)
+	case len(parts) == 2 && parts[0] == "assets" && r.Method == "DELETE":
+		id, _ := strconv.Atoi(parts[1])
+		a, ok := s.assets[id]
+		if !ok || a.ProjectId != p.ID {
+			writeErrors(w, http.StatusNotFound, "Asset not found")
+			return
+		}
+		delete(s.assets, id)
+		w.WriteHeader(http.StatusNoContent)
+	case sub == "assetstore" && r.Method == "GET":
+		var param struct {
+			AssetName string `json:"asset_name"`
+		}
+		json.Unmarshal(body, &param)
+		for _, a := range s.assets {
+			if a.ProjectId == p.ID && a.Name == param.AssetName {
+				w.Write(a.content)
+				return
+			}
+		}
+		writeErrors(w, http.StatusNotFound, "Asset not found")
+	case sub == "jobs" && r.Method == "GET":
+		jobs := s.userJobs(u, p.ID)
+		writeJSON(w, http.StatusOK, jobs)
+	case sub == "jobs" && r.Method == "POST":
+		s.createJob(w, p, body)
+	case len(parts) == 2 && parts[0] == "jobs" && r.Method == "GET":
+		id, _ := strconv.Atoi(parts[1])
+		j, ok := s.jobs[id]
+		if !ok || j.ProjectId != p.ID {
+			writeErrors(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		s.progress(j)
+		writeJSON(w, http.StatusOK, j)
+	default:
+		writeErrors(w, http.StatusNotFound, "Not found")
+	}
+}
+
+type credentials struct {
+	Email                string `json:"email"`
+	Password             string `json:"password"`
+	PasswordConfirmation string `json:"password_confirmation"`
+	Terms                struct {
+		Accepted bool `json:"accepted"`
+	} `json:"terms"`
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request, body []byte) {
+	var c credentials
+	if err := json.Unmarshal(body, &c); err != nil {
+		writeErrors(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	var fields []string
+	var messages []string
+	switch {
+	case !strings.Contains(c.Email, "@"):
+		fields, messages = append(fields, "email"), append(messages, "Email is not an email")
+	case s.users[c.Email] != nil:
+		fields, messages = append(fields, "email"), append(messages, "Email has already been taken")
+	}
+	if len(c.Password) < 6 {
+		fields, messages = append(fields, "password"), append(messages, "Password is too short (minimum is 6 characters)")
+	}
+	if c.PasswordConfirmation != "" && c.PasswordConfirmation != c.Password {
+		fields, messages = append(fields, "password_confirmation"), append(messages, "Password confirmation doesn't match Password")
+	}
+	if !c.Terms.Accepted {
+		fields, messages = append(fields, "terms"), append(messages, "Terms must be accepted")
+	}
+	if len(messages) > 0 {
+		errs := map[string]interface{}{"full_messages": messages}
+		for i, f := range fields {
+			errs[f] = []string{messages[i]}
+		}
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"status": "error", "errors": errs})
+		return
+	}
+
+	u := s.addUser(c.Email, c.Password)
+	if s.RequireConfirmation {
+		// like devise, no token is issued before the account is confirmed
+		u.Confirmed = false
+		s.sendConfirmation(r, u)
+	} else {
+		s.issueToken(w, u, "")
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "data": userData(u)})
+}
+
+func (s *Server) signIn(w http.ResponseWriter, r *http.Request, body []byte) {
+	var c credentials
+	json.Unmarshal(body, &c)
+	u := s.users[c.Email]
+	switch {
+	case u != nil && u.UnlockToken != "":
+		writeSignInError(w, "Your account has been locked due to an excessive number of unsuccessful sign in attempts.")
+		return
+	case u != nil && !u.Confirmed:
+		writeSignInError(w, fmt.Sprintf("A confirmation email was sent to your account at '%s'. You must follow the instructions in the email before your account can be activated", u.Email))
+		return
+	case u == nil || u.Password != c.Password:
+		if u != nil && s.LockAfter > 0 {
+			u.FailedAttempts++
+			if u.FailedAttempts >= s.LockAfter {
+				u.UnlockToken = randomHex()
+				s.sendUnlock(r, u)
+			}
+		}
+		writeSignInError(w, "Invalid login credentials. Please try again.")
+		return
+	}
+	u.FailedAttempts = 0
+	s.issueToken(w, u, "")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": userData(u)})
+}
+
+func writeSignInError(w http.ResponseWriter, message string) {
+	writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+		"success": false,
+		"errors":  []string{message},
+	})
+}
+
+func (s *Server) mail(to, subject, body string) {
+	if s.Mail != nil {
+		s.Mail(to, subject, body)
+	}
+}
+
+func (s *Server) sendConfirmation(r *http.Request, u *user) {
+	u.ConfirmationToken = randomHex()
+	s.mail(u.Email, "Confirmation instructions", "Confirm your account: http://"+r.Host+"/auth/confirmation?confirmation_token="+u.ConfirmationToken)
+}
+
+func (s *Server) sendUnlock(r *http.Request, u *user) {
+	s.mail(u.Email, "Unlock instructions", "Unlock your account: http://"+r.Host+"/auth/unlock?unlock_token="+u.UnlockToken)
+}
+
+// resendInstructions handles a request for another confirmation or unlock
+// email. pending tells whether the user needs one, send sends it.
+func (s *Server) resendInstructions(w http.ResponseWriter, body []byte, what, notPending string, pending func(*user) bool, send func(*user)) {
+	var c credentials
+	json.Unmarshal(body, &c)
+	u := s.users[c.Email]
+	switch {
+	case u == nil:
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"errors":  []string{fmt.Sprintf("Unable to find user with email '%s'.", c.Email)},
+		})
+	case !pending(u):
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"success": false,
+			"errors":  map[string]interface{}{"full_messages": []string{notPending}},
+		})
+	default:
+		send(u)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": fmt.Sprintf("An email has been sent to '%s' containing instructions for %s.", c.Email, what),
+		})
+	}
+}
+
+func (s *Server) resendConfirmation(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.resendInstructions(w, body, "confirming your account", "Email was already confirmed, please try signing in",
+		func(u *user) bool { return !u.Confirmed },
+		func(u *user) { s.sendConfirmation(r, u) })
+}
+
+func (s *Server) resendUnlock(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.resendInstructions(w, body, "unlocking your account", "Email was not locked",
+		func(u *user) bool { return u.UnlockToken != "" },
+		func(u *user) { s.sendUnlock(r, u) })
+}
+
+// confirm and unlock handle the links of the emails.
+func (s *Server) confirm(w http.ResponseWriter, token string) {
+	for _, u := range s.users {
+		if token != "" && u.ConfirmationToken == token {
+			u.Confirmed, u.ConfirmationToken = true, ""
+			w.Write([]byte("Your account has been confirmed.\n"))
+			return
+		}
+	}
+	writeErrors(w, http.StatusNotFound, "Invalid confirmation token")
+}
+
+func (s *Server) unlock(w http.ResponseWriter, token string) {
+	for _, u := range s.users {
+		if token != "" && u.UnlockToken == token {
+			u.UnlockToken, u.FailedAttempts = "", 0
+			w.Write([]byte("Your account has been unlocked.\n"))
+			return
+		}
+	}
+	writeErrors(w, http.StatusNotFound, "Invalid unlock token")
+}
+
+// requestPasswordReset pretends to send an email with a reset link.
+func (s *Server) requestPasswordReset(w http.ResponseWriter, body []byte) {
+	var c credentials
+	json.Unmarshal(body, &c)
+	if s.users[c.Email] == nil {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"errors":  []string{fmt.Sprintf("Unable to find user with email '%s'.", c.Email)},
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("An email has been sent to '%s' containing instructions for resetting your password.", c.Email),
+	})
+}
+
+func (s *Server) changePassword(w http.ResponseWriter, u *user, body []byte) {
+	var c struct {
+		credentials
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := json.Unmarshal(body, &c); err != nil {
+		writeErrors(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	var messages []string
+	if c.CurrentPassword != u.Password {
+		messages = append(messages, "Current password is invalid")
+	}
+	if len(c.Password) < 6 {
+		messages = append(messages, "Password is too short (minimum is 6 characters)")
+	}
+	if c.PasswordConfirmation != c.Password {
+		messages = append(messages, "Password confirmation doesn't match Password")
+	}
+	if len(messages) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"success": false,
+			"errors":  map[string]interface{}{"full_messages": messages},
+		})
+		return
+	}
+	u.Password = c.Password
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    userData(u),
+		"message": "Your password has been successfully updated.",
+	})
+}
+
+// authenticate checks the auth headers of r. On success, the auth headers
+// of the response are set (with a new token if RotateTokens is set).
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) *user {
+	u := s.users[r.Header.Get("uid")]
+	if u == nil {
+		return nil
+	}
+	client := r.Header.Get("client")
+	token, ok := u.Tokens[client]
+	if !ok || token != r.Header.Get("access-token") {
+		return nil
+	}
+	if s.RotateTokens {
+		s.issueToken(w, u, client)
+	} else {
+		s.setAuthHeaders(w, u, client, token)
+	}
+	return u
+}
+
+func (s *Server) issueToken(w http.ResponseWriter, u *user, client string) {
+	if client == "" {
+		client = randomHex()
+	}
+	token := randomHex()
+	u.Tokens[client] = token
+	s.setAuthHeaders(w, u, client, token)
+}
+
+func (s *Server) setAuthHeaders(w http.ResponseWriter, u *user, client, token string) {
+	w.Header().Set("access-token", token)
+	w.Header().Set("client", client)
+	w.Header().Set("uid", u.Email)
+	w.Header().Set("token-type", "Bearer")
+	w.Header().Set("expiry", strconv.FormatInt(time.Now().Add(s.TokenLifetime).Unix(), 10))
+}
+
+func (s *Server) deleteUser(u *user) {
+	for _, p := range s.projects {
+		if p.UserID == u.ID {
+			s.deleteProject(p)
+		}
+	}
+	delete(s.users, u.Email)
+}
+
+func (s *Server) userProjects(u *user, search string) []*project {
+	projects := make([]*project, 0)
+	for _, p := range s.projects {
+		if p.UserID == u.ID && strings.Contains(strings.ToLower(p.Name), strings.ToLower(search)) {
+			projects = append(projects, p)
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID < projects[j].ID })
+	return projects
+}
+
+func (s *Server) userProject(u *user, id string) *project {
+	pid, _ := strconv.Atoi(id)
+	p, ok := s.projects[pid]
+	if !ok || p.UserID != u.ID {
+		return nil
+	}
+	return p
+}
+
+func (s *Server) createProject(w http.ResponseWriter, u *user, body []byte) {
+	var param struct {
+		Project project `json:"project"`
+	}
+	json.Unmarshal(body, &param)
+	if strings.TrimSpace(param.Project.Name) == "" {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"errors": map[string][]string{"name": {"can't be blank"}},
+		})
+		return
+	}
+	for _, p := range s.userProjects(u, "") {
+		if p.Name == param.Project.Name {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"errors": map[string][]string{"name": {"has already been taken"}},
+			})
+			return
+		}
+	}
+	now := time.Now().UTC()
+	p := &project{
+		ID:        s.id(),
+		Name:      param.Project.Name,
+		Details:   param.Project.Details,
+		Settings:  "{}",
+		UserID:    u.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.projects[p.ID] = p
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func (s *Server) deleteProject(p *project) {
+	for id, a := range s.assets {
+		if a.ProjectId == p.ID {
+			delete(s.assets, id)
+		}
+	}
+	for id, j := range s.jobs {
+		if j.ProjectId == p.ID {
+			delete(s.jobs, id)
+		}
+	}
+	delete(s.projects, p.ID)
+}
+
+func (s *Server) userAssets(u *user, projectID int) []*asset {
+	assets := make([]*asset, 0)
+	for _, a := range s.assets {
+		p := s.projects[a.ProjectId]
+		if p != nil && p.UserID == u.ID && (projectID == 0 || projectID == p.ID) {
+			assets = append(assets, a)
+		}
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].ID < assets[j].ID })
+	return assets
+}
+
+func (s *Server) createAsset(w http.ResponseWriter, p *project, body []byte) {
+	var param struct {
+		Asset struct {
+			Name  string `json:"name"`
+			Asset string `json:"asset"`
+		} `json:"asset"`
+	}
+	json.Unmarshal(body, &param)
+	content, err := decodeDataURI(param.Asset.Asset)
+	if err != nil || param.Asset.Name == "" {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"errors": map[string][]string{"asset": {"is invalid"}},
+		})
+		return
+	}
+	a := s.addAsset(p, param.Asset.Name, "upload", content)
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func (s *Server) addAsset(p *project, name, origin string, content []byte) *asset {
+	// an asset of the same name is replaced
+	for id, a := range s.assets {
+		if a.ProjectId == p.ID && a.Name == name {
+			delete(s.assets, id)
+		}
+	}
+	now := time.Now().UTC()
+	a := &asset{
+		ID:          s.id(),
+		Name:        name,
+		ProjectId:   p.ID,
+		ProjectName: p.Name,
+		Origin:      origin,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		content:     content,
+	}
+	s.assets[a.ID] = a
+	return a
+}
+
+func (s *Server) userJobs(u *user, projectID int) []*job {
+	jobs := make([]*job, 0)
+	for _, j := range s.jobs {
+		p := s.projects[j.ProjectId]
+		if p != nil && p.UserID == u.ID && (projectID == 0 || projectID == p.ID) {
+			s.progress(j)
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].ID < jobs[k].ID })
+	return jobs
+}
+
+func (s *Server) createJob(w http.ResponseWriter, p *project, body []byte) {
+	var param struct {
+		Job job `json:"job"`
+	}
+	json.Unmarshal(body, &param)
+	if param.Job.Kind != "build" && param.Job.Kind != "validate" {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"errors": map[string][]string{"kind": {"is not included in the list"}},
+		})
+		return
+	}
+	now := time.Now().UTC()
+	j := &job{
+		ID:          s.id(),
+		Kind:        param.Job.Kind,
+		Status:      "created",
+		ProjectId:   p.ID,
+		ProjectName: p.Name,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.jobs[j.ID] = j
+	s.progress(j)
+	writeJSON(w, http.StatusCreated, j)
+}
+
+// progress advances a job according to the time passed since its creation:
+// created -> processing (after half of JobDuration) -> processed.
+func (s *Server) progress(j *job) {
+	if j.Status == "processed" {
+		return
+	}
+	elapsed := time.Since(j.CreatedAt)
+	switch {
+	case elapsed >= s.JobDuration:
+		j.Status = "processed"
+		j.UpdatedAt = time.Now().UTC()
+		s.finish(j)
+	case elapsed >= s.JobDuration/2 && j.Status != "processing":
+		j.Status = "processing"
+		j.UpdatedAt = time.Now().UTC()
+	}
+}
+
+func (s *Server) finish(j *job) {
+	p := s.projects[j.ProjectId]
+	var names []string
+	for _, a := range s.assets {
+		if a.ProjectId == j.ProjectId && a.Origin == "upload" {
+			names = append(names, a.Name)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		j.Results = jobResults{
+			ResultStatus:  1,
+			ResultMessage: "Project has no assets",
+			ResultDetails: []string{"Add API specifications with `slyft asset add` first."},
+		}
+		return
+	}
+
+	j.Results.ResultMessage = fmt.Sprintf("%s of %d asset(s) successful", j.Kind, len(names))
+	j.Results.ResultDetails = names
+	if j.Kind == "build" && p != nil {
+		name := p.Name + "-build.txt"
+		s.addAsset(p, name, "build", []byte("Generated by the slyft mock backend from "+strings.Join(names, ", ")+"\n"))
+		j.Results.ResultAssets = []string{name}
+	}
+}
+
+func userData(u *user) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       u.ID,
+		"email":    u.Email,
+		"uid":      u.Email,
+		"provider": "email",
+	}
+}
+
+func decodeDataURI(uri string) ([]byte, error) {
+	i := strings.Index(uri, ";base64,")
+	if !strings.HasPrefix(uri, "data:") || i < 0 {
+		return nil, fmt.Errorf("not a base64 data URI")
+	}
+	return base64.StdEncoding.DecodeString(uri[i+len(";base64,"):])
+}
+
+func randomHex() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeErrors(w http.ResponseWriter, status int, messages ...string) {
+	writeJSON(w, status, map[string][]string{"errors": messages})
+}
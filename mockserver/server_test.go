@@ -0,0 +1,218 @@
+package mockserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thingforward/slyft-cli/slyft"
+)
+
+func signIn(t *testing.T, c *slyft.Client, email, password string) slyft.Auth {
+	resp, err := c.CallNoAuth(context.Background(), "POST", "/auth/sign_in", map[string]string{"email": email, "password": password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := slyft.CheckResponse(resp, http.StatusOK); err != nil {
+		t.Fatalf("Must sign in: %v", err)
+	}
+	return slyft.AuthFromHeader(resp.Header)
+}
+
+func TestSignIn(t *testing.T) {
+	srv := New()
+	srv.AddUser("foo@bar.boo", "secret")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := slyft.NewClient(ts.URL, nil, nil)
+	resp, _ := c.CallNoAuth(context.Background(), "POST", "/auth/sign_in", map[string]string{"email": "foo@bar.boo", "password": "wrong"})
+	err := slyft.CheckResponse(resp, http.StatusOK)
+	if e, ok := err.(*slyft.APIError); !ok || e.StatusCode != http.StatusUnauthorized || len(e.Messages) != 1 {
+		t.Errorf("Expected login failure with message, got %#v", err)
+	}
+
+	auth := signIn(t, c, "foo@bar.boo", "secret")
+	if !auth.Valid() || auth.Expiry == 0 {
+		t.Errorf("Expected credentials, got %+v", auth)
+	}
+
+	c.AuthSource = slyft.StaticAuth(auth)
+	if u, err := c.ValidateToken(context.Background()); err != nil || u.Uid != "foo@bar.boo" {
+		t.Errorf("Must validate token, got %+v (%v)", u, err)
+	}
+
+	c.AuthSource = slyft.StaticAuth(slyft.Auth{AccessToken: "forged", Client: auth.Client, Uid: auth.Uid})
+	if _, err := c.Projects.List(context.Background()); !slyft.IsUnauthorized(err) {
+		t.Errorf("Must reject invalid token, got %v", err)
+	}
+	if _, err := c.ValidateToken(context.Background()); !slyft.IsUnauthorized(err) {
+		t.Errorf("Must not validate invalid token, got %v", err)
+	}
+}
+
+func TestPassword(t *testing.T) {
+	srv := New()
+	srv.AddUser("foo@bar.boo", "secret")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := slyft.NewClient(ts.URL, nil, nil)
+	c.AuthSource = slyft.StaticAuth(signIn(t, c, "foo@bar.boo", "secret"))
+	change := func(current, password, confirmation string) error {
+		resp, err := c.Call(context.Background(), "PUT", "/auth/password", map[string]string{
+			"current_password": current, "password": password, "password_confirmation": confirmation,
+		})
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return slyft.CheckResponse(resp, http.StatusOK)
+	}
+	if err := change("wrong", "secret2", "secret2"); err == nil {
+		t.Error("Must reject wrong current password")
+	}
+	if err := change("secret", "secret2", "secret3"); err == nil {
+		t.Error("Must reject mismatching confirmation")
+	}
+	if err := change("secret", "secret2", "secret2"); err != nil {
+		t.Fatalf("Must change password: %v", err)
+	}
+	signIn(t, c, "foo@bar.boo", "secret2")
+
+	reset := func(email string) error {
+		resp, err := c.CallNoAuth(context.Background(), "POST", "/auth/password", map[string]string{"email": email})
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return slyft.CheckResponse(resp, http.StatusOK)
+	}
+	if err := reset("foo@bar.boo"); err != nil {
+		t.Errorf("Must accept password reset: %v", err)
+	}
+	if err := reset("nobody@bar.boo"); !slyft.IsNotFound(err) {
+		t.Errorf("Must reject password reset of unknown user, got %v", err)
+	}
+}
+
+func TestConfirmationAndUnlock(t *testing.T) {
+	srv := New()
+	srv.RequireConfirmation = true
+	srv.LockAfter = 2
+	links := map[string]string{}
+	srv.Mail = func(to, subject, body string) {
+		links[subject] = body[strings.Index(body, "http"):]
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := slyft.NewClient(ts.URL, nil, nil)
+	post := func(resource string, params interface{}) error {
+		resp, err := c.CallNoAuth(context.Background(), "POST", resource, params)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return slyft.CheckResponse(resp, http.StatusOK)
+	}
+	visit := func(link string) {
+		resp, err := http.Get(link)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("Must follow %s: %v", link, err)
+		}
+		resp.Body.Close()
+	}
+	signInError := func(password string) string {
+		err := post("/auth/sign_in", map[string]string{"email": "foo@bar.boo", "password": password})
+		if e, ok := err.(*slyft.APIError); ok && len(e.Messages) == 1 {
+			return e.Messages[0]
+		}
+		return fmt.Sprint(err)
+	}
+
+	err := post("/auth", map[string]interface{}{"email": "foo@bar.boo", "password": "secret", "terms": map[string]bool{"accepted": true}})
+	if err != nil || links["Confirmation instructions"] == "" {
+		t.Fatalf("Must register and send confirmation email: %v", err)
+	}
+	if msg := signInError("secret"); !strings.Contains(msg, "confirmation email") {
+		t.Errorf("Must reject unconfirmed account, got %s", msg)
+	}
+	first := links["Confirmation instructions"]
+	if err := post("/auth/confirmation", map[string]string{"email": "foo@bar.boo"}); err != nil || links["Confirmation instructions"] == first {
+		t.Errorf("Must resend confirmation email: %v", err)
+	}
+	visit(links["Confirmation instructions"])
+	if err := post("/auth/confirmation", map[string]string{"email": "foo@bar.boo"}); err == nil {
+		t.Error("Must not resend confirmation for confirmed account")
+	}
+	signIn(t, c, "foo@bar.boo", "secret")
+
+	signInError("wrong")
+	signInError("wrong")
+	if msg := signInError("secret"); !strings.Contains(msg, "locked") {
+		t.Errorf("Must lock account, got %s", msg)
+	}
+	if err := post("/auth/unlock", map[string]string{"email": "foo@bar.boo"}); err != nil {
+		t.Errorf("Must resend unlock email: %v", err)
+	}
+	visit(links["Unlock instructions"])
+	signIn(t, c, "foo@bar.boo", "secret")
+}
+
+func TestProjectLifecycle(t *testing.T) {
+	srv := New()
+	srv.JobDuration = 20 * time.Millisecond
+	srv.AddUser("foo@bar.boo", "secret")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := slyft.NewClient(ts.URL, nil, nil)
+	c.AuthSource = slyft.StaticAuth(signIn(t, c, "foo@bar.boo", "secret"))
+	ctx := context.Background()
+
+	p, err := c.Projects.Create(ctx, "demo", "details")
+	if err != nil {
+		t.Fatalf("Must create project: %v", err)
+	}
+	if _, err := c.Projects.Create(ctx, "demo", ""); err == nil {
+		t.Error("Must reject duplicate project names")
+	}
+	if found, _ := c.Projects.Search(ctx, "DEM"); len(found) != 1 || found[0].ID != p.ID {
+		t.Errorf("Must find project, got %+v", found)
+	}
+
+	spec := []byte(`{"swagger": "2.0"}`)
+	if _, err := c.Assets.Upload(ctx, p.ID, "api.json", spec, "application/json"); err != nil {
+		t.Fatalf("Must upload asset: %v", err)
+	}
+	var b bytes.Buffer
+	if err := c.Assets.Download(ctx, p.ID, "api.json", &b); err != nil || b.String() != string(spec) {
+		t.Errorf("Must download asset, got %q (%v)", b.String(), err)
+	}
+
+	j, err := c.Jobs.Create(ctx, p.ID, "build")
+	if err != nil {
+		t.Fatalf("Must create job: %v", err)
+	}
+	j, err = c.Jobs.Wait(ctx, j, 10*time.Millisecond, nil)
+	if err != nil || !j.Processed() || len(j.Results.ResultAssets) != 1 {
+		t.Fatalf("Must process job, got %+v (%v)", j, err)
+	}
+	if assets, _ := c.Assets.List(ctx, p.ID); len(assets) != 2 {
+		t.Errorf("Expected uploaded and generated asset, got %+v", assets)
+	}
+
+	if err := c.Projects.Delete(ctx, p.ID); err != nil {
+		t.Errorf("Must delete project: %v", err)
+	}
+	if _, err := c.Projects.Get(ctx, p.ID); !slyft.IsNotFound(err) {
+		t.Errorf("Expected deleted project to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// output format given by --output, see main()
+var fOutput *string
+
+// outputFormat of command results, see setupOutput
+var outputFormat = "text"
+
+// setupOutput determines the output format from --output, SLYFT_OUTPUT and
+// the config, in this order.
+func setupOutput() error {
+	outputFormat = currentSettings().Output
+	if fOutput != nil && *fOutput != "" {
+		outputFormat = *fOutput
+	}
+	if outputFormat == "" {
+		outputFormat = "text"
+	}
+	return oneOf("text", "json")(outputFormat)
+}
+
+// outputJSON reports whether results are printed as JSON instead of tables.
+func outputJSON() bool {
+	return outputFormat == "json"
+}
+
+// printJSON prints v as indented JSON.
+func printJSON(v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		ReportError("Formatting the output", err)
+		return
+	}
+	fmt.Println(string(b))
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// passwords need at least this score of passwordStrength at registration
+const minPasswordScore = 2
+
+// commonPasswords are among the most frequently used passwords, and
+// keyboard patterns that make up many others.
+var commonPasswords = []string{
+	"123456", "1234567", "12345678", "123456789", "1234567890", "123123",
+	"654321", "111111", "000000", "121212", "666666", "696969", "112233",
+	"password", "passwort", "passw0rd", "pass", "secret", "letmein", "welcome",
+	"qwerty", "qwertz", "azerty", "asdf", "asdfgh", "zxcvbn", "qazwsx",
+	"1q2w3e", "1qaz2wsx", "abc123", "abcdef", "iloveyou", "admin", "root",
+	"login", "master", "monkey", "dragon", "football", "baseball", "soccer",
+	"hockey", "superman", "batman", "trustno1", "sunshine", "princess",
+	"shadow", "michael", "jennifer", "jordan", "hunter", "ranger", "buster",
+	"charlie", "thomas", "computer", "internet", "starwars", "whatever",
+	"freedom", "hello", "flower", "cheese", "summer", "winter", "changeme",
+	"default", "slyft",
+}
+
+// leetspeak substitutions undone before comparing with commonPasswords
+var unleet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+// passwordStrength estimates how hard password is to guess, from 0 (easily
+// guessed) to 4 (strong), and suggests how to improve it. The estimate is
+// based on the entropy of the characters used, not counting repeated or
+// sequential characters, and on checks against common passwords and the
+// email address of the account.
+func passwordStrength(password, email string) (int, []string) {
+	var hints []string
+
+	bits := passwordEntropy(password)
+	score := 0
+	switch {
+	case bits >= 80:
+		score = 4
+	case bits >= 60:
+		score = 3
+	case bits >= 40:
+		score = 2
+	case bits >= 28:
+		score = 1
+	}
+	if score < 3 {
+		if len([]rune(password)) < 12 {
+			hints = append(hints, "Use a longer password, e.g. several unrelated words")
+		}
+		if characterClasses(password) < 3 {
+			hints = append(hints, "Mix upper and lower case letters, digits and symbols")
+		}
+	}
+
+	lower := strings.ToLower(password)
+	if hasPredictableRun(lower) {
+		hints = append(hints, "Avoid repeated characters and sequences like 'aaa' or '123'")
+	}
+	if isCommonPassword(lower) {
+		score = 0
+		hints = append(hints, "Avoid common passwords and keyboard patterns")
+	}
+	if resemblesEmail(lower, strings.ToLower(email)) {
+		if score > 1 {
+			score = 1
+		}
+		hints = append(hints, "Avoid parts of your email address")
+	}
+	return score, hints
+}
+
+// passwordEntropy returns the bits of entropy of password, where repeated
+// and sequential characters count as one bit only.
+func passwordEntropy(password string) float64 {
+	pool := 0
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	for _, c := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.present {
+			pool += c.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	perChar := math.Log2(float64(pool))
+	bits := 0.0
+	var prev rune
+	for i, r := range []rune(strings.ToLower(password)) {
+		if i > 0 && (r == prev || r == prev+1 || r == prev-1) {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev = r
+	}
+	return bits
+}
+
+func characterClasses(password string) int {
+	n := 0
+	for _, class := range []func(rune) bool{unicode.IsLower, unicode.IsUpper, unicode.IsDigit, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}} {
+		if strings.IndexFunc(password, class) >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// hasPredictableRun reports whether s contains three or more repeated or
+// sequential characters.
+func hasPredictableRun(s string) bool {
+	r := []rune(s)
+	for i := 2; i < len(r); i++ {
+		d1, d2 := r[i-1]-r[i-2], r[i]-r[i-1]
+		if d1 == d2 && (d1 == 0 || d1 == 1 || d1 == -1) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCommonPassword reports whether password is a common password, possibly
+// in leetspeak or with digits and symbols around it (e.g. "P@ssw0rd123!").
+func isCommonPassword(password string) bool {
+	trimmed := strings.TrimFunc(password, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, p := range []string{password, trimmed, unleet.Replace(password), unleet.Replace(trimmed)} {
+		for _, common := range commonPasswords {
+			if p == common {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resemblesEmail reports whether password contains the name or domain of
+// email, or the other way around.
+func resemblesEmail(password, email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	if dot := strings.Index(domain, "."); dot > 0 {
+		domain = domain[:dot]
+	}
+	stripped := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, password)
+	for _, part := range append(strings.FieldsFunc(email[:at], func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), email[:at], domain) {
+		if len(part) < 3 {
+			continue
+		}
+		if strings.Contains(password, part) || strings.Contains(stripped, part) {
+			return true
+		}
+		if len(stripped) >= 3 && strings.Contains(part, stripped) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestPasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		email    string
+		weak     bool
+	}{
+		{"secret12", "", true},
+		{"password123", "", true},
+		{"P@ssw0rd!", "", true},
+		{"qwertz", "", true},
+		{"aaaaaaaaaaaa", "", true},
+		{"abcdefgh1234", "", true},
+		{"98765432", "", true},
+		{"Foobar-2017x", "foobar@example.com", true},
+		{"example#Stuff42", "jane@example.com", true},
+		{"glacier-Mango-47", "", false},
+		{"correct horse battery staple", "", false},
+		{"Tr0ub4dor&3", "jane@example.com", false},
+	}
+	for _, tt := range tests {
+		score, hints := passwordStrength(tt.password, tt.email)
+		if weak := score < minPasswordScore; weak != tt.weak {
+			t.Errorf("%s: expected weak=%v, got score %d", tt.password, tt.weak, score)
+		}
+		if tt.weak && len(hints) == 0 {
+			t.Errorf("%s: must give hints for a weak password", tt.password)
+		}
+	}
+}
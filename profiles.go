@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	cli "github.com/jawher/mow.cli"
+	"github.com/thingforward/slyft-cli/slyft"
+)
+
+// the profile stored at the top level of the config file
+const defaultProfile = "default"
+
+var validProfileName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// profile given by --profile or SLYFT_PROFILE, see main()
+var fProfile *string
+
+// Profile is a named set of backend, credentials and settings, so that one
+// can switch between e.g. production, staging and a personal account
+// without logging in and out.
+type Profile struct {
+	Auth SlyftAuth
+	// Settings override those of the default profile
+	Settings
+}
+
+// profileName returns the name of the active profile: --profile or
+// SLYFT_PROFILE, then the profile selected by `slyft profile use`.
+func (sr *SlyftRC) profileName() string {
+	if fProfile != nil && *fProfile != "" {
+		return *fProfile
+	}
+	if sr.CurrentProfile != "" {
+		return sr.CurrentProfile
+	}
+	return defaultProfile
+}
+
+// profile returns the active profile, or nil for the default profile.
+func (sr *SlyftRC) profile() (*Profile, error) {
+	name := sr.profileName()
+	if name == defaultProfile {
+		return nil, nil
+	}
+	p, ok := sr.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown profile %s, see `slyft profile list`", name)
+	}
+	return p, nil
+}
+
+// authOf returns the credentials of profile as kept in the config file,
+// see plaintextStore. They can be modified in place before writing the
+// config.
+func (sr *SlyftRC) authOf(profile string) *SlyftAuth {
+	if p := sr.Profiles[profile]; p != nil && profile != defaultProfile {
+		return &p.Auth
+	}
+	return &sr.Auth
+}
+
+// settings returns the settings of the active profile, falling back to the
+// default profile for settings it does not define.
+func (sr *SlyftRC) settings() Settings {
+	return sr.settingsOf(sr.profileName())
+}
+
+// settingsOf returns the settings of profile, see settings.
+func (sr *SlyftRC) settingsOf(profile string) Settings {
+	s := sr.Settings
+	if p := sr.Profiles[profile]; p != nil && profile != defaultProfile {
+		for i := range configKeys {
+			configKeys[i].copyIfSet(&s, &p.Settings)
+		}
+	}
+	return s
+}
+
+// backendURL returns the backend to talk to: SLYFTBACKEND, then the backend
+// of the active profile, then the one for the negotiated API version, then
+// the production backend.
+func backendURL() string {
+	if b := currentSettings().Backend; b != "" {
+		return b
+	}
+	if apiEndpoint != "" {
+		return apiEndpoint
+	}
+	return slyft.DefaultBaseURL
+}
+
+// checkProfile makes sure that the active profile exists.
+func checkProfile() error {
+	sr, _ := readConfig()
+	_, err := sr.profile()
+	return err
+}
+
+func listProfiles(cmd *cli.Cmd) {
+	cmd.Action = func() {
+		sr, _ := readConfig()
+		active := sr.profileName()
+
+		names := []string{defaultProfile}
+		for name := range sr.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names[1:])
+
+		data := [][]string{
+			[]string{"Active", "Name", "Backend", "User"},
+		}
+		for _, name := range names {
+			backend := sr.Backend
+			if p := sr.Profiles[name]; p != nil {
+				overrideString(&backend, &p.Backend)
+			}
+			if backend == "" {
+				backend = slyft.DefaultBaseURL
+			}
+			mark := ""
+			if name == active {
+				mark = "*"
+			}
+			user := "(not logged in)"
+			store, err := sr.credentialStore(name)
+			var auth *SlyftAuth
+			if err == nil {
+				auth, err = store.Get(name)
+			}
+			switch {
+			case err != nil:
+				Log.Debugf("Reading the credentials of %s failed: %s", name, err)
+				user = "(unknown)"
+			case auth.GoodForLogin():
+				user = auth.Uid
+			}
+			data = append(data, []string{mark, name, backend, user})
+		}
+		fmt.Fprint(os.Stdout, markdownTable(&data))
+		if b := os.Getenv("SLYFTBACKEND"); b != "" {
+			fmt.Printf("Note: SLYFTBACKEND is set, all profiles use %s\n", b)
+		}
+	}
+}
+
+func useProfile(cmd *cli.Cmd) {
+	cmd.Spec = "NAME"
+	name := cmd.StringArg("NAME", "", "Name of the profile")
+
+	cmd.Action = func() {
+		found := *name == defaultProfile
+		err := updateConfig(func(sr *SlyftRC) bool {
+			if !found {
+				if _, found = sr.Profiles[*name]; !found {
+					return false
+				}
+			}
+			sr.CurrentProfile = *name
+			if *name == defaultProfile {
+				sr.CurrentProfile = ""
+			}
+			return true
+		})
+		switch {
+		case err != nil:
+			ReportError("Switching the profile", err)
+			cli.Exit(1)
+		case !found:
+			fmt.Printf("Unknown profile %s, see `slyft profile list`\n", *name)
+			cli.Exit(1)
+		}
+		fmt.Printf("Now using profile %s\n", *name)
+	}
+}
+
+func addProfile(cmd *cli.Cmd) {
+	cmd.Spec = "[--backend] [--use] NAME"
+	backend := cmd.StringOpt("backend b", "", "URL of the backend (default: production)")
+	use := cmd.BoolOpt("use u", false, "Switch to the new profile")
+	name := cmd.StringArg("NAME", "", "Name of the new profile")
+
+	cmd.Action = func() {
+		*backend = strings.TrimSpace(*backend)
+		if !validProfileName.MatchString(*name) || *name == defaultProfile {
+			fmt.Printf("Invalid profile name %s, use letters, digits, '.', '_' and '-'\n", *name)
+			cli.Exit(1)
+		}
+		if *backend != "" {
+			if err := validateBackendURL(*backend); err != nil {
+				fmt.Println(err)
+				cli.Exit(1)
+			}
+		}
+
+		exists := false
+		err := updateConfig(func(sr *SlyftRC) bool {
+			if _, exists = sr.Profiles[*name]; exists {
+				return false
+			}
+			if sr.Profiles == nil {
+				sr.Profiles = map[string]*Profile{}
+			}
+			sr.Profiles[*name] = &Profile{Settings: Settings{Backend: *backend}}
+			if *use {
+				sr.CurrentProfile = *name
+			}
+			return true
+		})
+		switch {
+		case err != nil:
+			ReportError("Adding the profile", err)
+			cli.Exit(1)
+		case exists:
+			fmt.Printf("Profile %s already exists\n", *name)
+			cli.Exit(1)
+		}
+		fmt.Printf("Added profile %s. Log in with `slyft --profile %s user login`\n", *name, *name)
+	}
+}
+
+func removeProfile(cmd *cli.Cmd) {
+	cmd.Spec = "NAME"
+	name := cmd.StringArg("NAME", "", "Name of the profile")
+
+	cmd.Action = func() {
+		if *name == defaultProfile {
+			fmt.Println("The default profile cannot be removed")
+			cli.Exit(1)
+		}
+		if !askForConfirmation(fmt.Sprintf("Remove profile %s including its credentials?", *name)) {
+			return
+		}
+
+		found := false
+		var eraseErr error
+		err := updateConfig(func(sr *SlyftRC) bool {
+			if _, found = sr.Profiles[*name]; !found {
+				return false
+			}
+			// the profile is kept if its credentials cannot be erased
+			store, err := sr.credentialStore(*name)
+			if err == nil {
+				err = store.Erase(*name)
+			}
+			if eraseErr = err; err != nil {
+				return false
+			}
+			delete(sr.Profiles, *name)
+			if sr.CurrentProfile == *name {
+				sr.CurrentProfile = ""
+			}
+			return true
+		})
+		switch {
+		case err != nil:
+			ReportError("Removing the profile", err)
+			cli.Exit(1)
+		case eraseErr != nil:
+			ReportError("Erasing the credentials of profile "+*name, eraseErr)
+			cli.Exit(1)
+		case !found:
+			fmt.Printf("Unknown profile %s, see `slyft profile list`\n", *name)
+			cli.Exit(1)
+		}
+		fmt.Printf("Removed profile %s\n", *name)
+	}
+}
+
+func RegisterProfileRoutes(profile *cli.Cmd) {
+	SetupLogger()
+
+	profile.Command("list ls", "List your profiles", listProfiles)
+	profile.Command("use", "Switch to another profile", useProfile)
+	profile.Command("add a", "Add a profile", addProfile)
+	profile.Command("remove rm", "Remove a profile", removeProfile)
+}
@@ -2,49 +2,28 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"strconv"
-	"time"
 
 	"strings"
 
 	"github.com/jawher/mow.cli"
+	"github.com/thingforward/slyft-cli/slyft"
 )
 
-type Project struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Details   string    `json:"details"`
-	Settings  string    `json:"settings"`
-	UserID    int       `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+// projectModel makes a project deletable through DeleteApiModel.
+type projectModel struct {
+	*slyft.Project
 }
 
-func (p *Project) getName() string {
+func (p projectModel) getName() string {
 	return p.Name
 }
 
-type ProjectParam struct {
-	Project Project `json:"project"`
-}
-
-type SearchString struct {
-	SearchString string `json:"search_string"`
-}
-
-func createProjectParam(name, details, settings string) *ProjectParam {
-	return &ProjectParam{
-		Project{
-			Name:     name,
-			Details:  details,
-			Settings: settings,
-		},
-	}
+func (p projectModel) remove() error {
+	return API().Projects.Delete(requestContext(), p.ID)
 }
 
 func ReadUserIntInput(prompt string) (int, error) {
@@ -67,10 +46,14 @@ func ReadUserInput(prompt string) string {
 	return strings.TrimSpace(resp)
 }
 
-func (p *Project) Display() { // String?
+func displayProject(p *slyft.Project) {
 	if p == nil {
 		return
 	}
+	if outputJSON() {
+		printJSON(p)
+		return
+	}
 
 	data := [][]string{
 		[]string{"Key", "Value"},
@@ -85,14 +68,19 @@ func (p *Project) Display() { // String?
 		markdownTable(&data))
 }
 
-func DisplayProjects(projects []Project) {
+func DisplayProjects(projects []slyft.Project) {
+	if outputJSON() {
+		printJSON(projects)
+		return
+	}
+
 	if len(projects) == 0 {
 		fmt.Println("No projects found")
 		return
 	}
 
 	if len(projects) == 1 {
-		projects[0].Display()
+		displayProject(&projects[0])
 		return
 	}
 
@@ -106,44 +94,6 @@ func DisplayProjects(projects []Project) {
 	fmt.Fprint(os.Stdout, markdownTable(&data))
 }
 
-func extractProjectsFromBody(body []byte) ([]Project, error) {
-	//Log.Debugf("body=%v", string(body))
-	projects := make([]Project, 0)
-	if err := json.Unmarshal(body, &projects); err != nil {
-		return nil, err
-	}
-	return projects, nil
-}
-
-func extractProjectFromBody(body []byte) ([]Project, error) {
-	//Log.Debugf("body=%v", string(body))
-	p := &Project{}
-
-	if err := json.Unmarshal(body, &p); err != nil {
-		return nil, err
-	}
-	return []Project{*p}, nil
-}
-
-func displayProjectsFromResponse(resp *http.Response, expectedCode int, listExpected bool) error {
-	projects, err := extractProjectFromResponse(resp, expectedCode, listExpected)
-	if err != nil {
-		Log.Fatalf("Unable to list projects: %s", err)
-		return err
-	}
-	Log.Debugf("projects=%+v", projects)
-
-	if listExpected {
-		DisplayProjects(projects)
-	} else {
-		if len(projects) == 1 {
-			projects[0].Display()
-		}
-	}
-
-	return nil
-}
-
 func createProject(cmd *cli.Cmd) {
 	cmd.Spec = "[--name] [--remember]"
 	name := cmd.StringOpt("name n", "", "Name for the project")
@@ -163,13 +113,12 @@ func createProject(cmd *cli.Cmd) {
 		}
 
 		projectDetails := ReadUserInput("Details to the project (optional): ")
-		resp, err := Do("/v1/projects", "POST", createProjectParam(*name, projectDetails, ""))
+		p, err := API().Projects.Create(requestContext(), *name, projectDetails)
 		if err != nil {
-			ReportError("Contacting the server", err)
+			ReportError("Creating the project", err)
 			return
 		}
-		defer resp.Body.Close()
-		displayProjectsFromResponse(resp, http.StatusCreated, false)
+		displayProject(p)
 
 		if remember != nil && *remember {
 			_, err := os.Open(".slyftproject")
@@ -214,31 +163,21 @@ func settingsProject(cmd *cli.Cmd) {
 			*name, _ = ReadProjectLock()
 		}
 		p, err := chooseProject(*name, "Which project needs to be updated: ")
-		if err == nil {
-			resp, err := Do(p.EndPoint(), "PUT", createProjectParam("", "", fmt.Sprintf(`{"%s": "%s"}`, *key, *value)))
-			defer resp.Body.Close()
-			if err != nil || resp.StatusCode != http.StatusNoContent {
-				fmt.Printf("Something went wrong: %s\n", err)
-			} else {
-				fmt.Println("Successfully updated")
-				resp, err := Do(p.EndPoint(), "GET", nil)
-				defer resp.Body.Close()
-				if err == nil {
-					displayProjectsFromResponse(resp, http.StatusOK, false)
-					return
-				}
-			}
+		if err != nil {
+			ReportError("Choosing a project", err)
 			return
 		}
-		ReportError("Choosing a project", err)
-	}
-}
-
-func FindProjects(portion string) (*http.Response, error) {
-	if strings.TrimSpace(portion) == "" {
-		return Do("/v1/projects", "GET", nil)
+		err = API().Projects.UpdateSettings(requestContext(), p.ID, fmt.Sprintf(`{"%s": "%s"}`, *key, *value))
+		if err != nil {
+			fmt.Printf("Something went wrong: %s\n", err)
+			return
+		}
+		fmt.Println("Successfully updated")
+		p, err = API().Projects.Get(requestContext(), p.ID)
+		if err == nil {
+			displayProject(p)
+		}
 	}
-	return Do("/v1/projects/search", "GET", &SearchString{portion})
 }
 
 func listProjects(cmd *cli.Cmd) {
@@ -246,25 +185,18 @@ func listProjects(cmd *cli.Cmd) {
 	name := cmd.StringOpt("name", "", "Name for the project")
 
 	cmd.Action = func() {
-		resp, err := FindProjects(*name)
-		Log.Debugf("err=%#v", err)
-		Log.Debugf("resp=%#v", resp)
+		projects, err := API().Projects.Search(requestContext(), *name)
 		if err != nil {
 			ReportError("Listing the projects", err)
 			return
 		}
-		defer resp.Body.Close()
-		displayProjectsFromResponse(resp, http.StatusOK, true)
+		Log.Debugf("projects=%+v", projects)
+		DisplayProjects(projects)
 	}
 }
 
-func chooseProject(portion, message string) (*Project, error) {
-	resp, err := FindProjects(portion)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	projects, err := extractProjectFromResponse(resp, http.StatusOK, true)
+func chooseProject(portion, message string) (*slyft.Project, error) {
+	projects, err := API().Projects.Search(requestContext(), portion)
 	if err != nil {
 		return nil, err
 	}
@@ -284,29 +216,13 @@ func chooseProject(portion, message string) (*Project, error) {
 		return nil, err
 	}
 
-	if choice > len(projects) {
+	if choice < 1 || choice > len(projects) {
 		return nil, errors.New("Plese choose a number from the first column")
 	}
 
 	return &projects[choice-1], nil
 }
 
-func (p *Project) EndPoint() string {
-	return fmt.Sprintf("/v1/projects/%d", p.ID)
-}
-
-func (p *Project) AssetsUrl() string {
-	return p.EndPoint() + "/assets"
-}
-
-func (p *Project) AssetstoreUrl() string {
-	return p.EndPoint() + "/assetstore"
-}
-
-func (p *Project) JobsUrl() string {
-	return p.EndPoint() + "/jobs"
-}
-
 func showProject(cmd *cli.Cmd) {
 	cmd.Spec = "[--name]"
 	name := cmd.StringOpt("name", "", "Name of the project")
@@ -317,10 +233,9 @@ func showProject(cmd *cli.Cmd) {
 		}
 		p, err := chooseProject(*name, "Which project needs to be displayed in detail: ")
 		if err == nil {
-			resp, err := Do(p.EndPoint(), "GET", nil)
-			defer resp.Body.Close()
+			p, err = API().Projects.Get(requestContext(), p.ID)
 			if err == nil {
-				displayProjectsFromResponse(resp, http.StatusOK, false)
+				displayProject(p)
 				return
 			}
 		}
@@ -342,7 +257,7 @@ func deleteProject(cmd *cli.Cmd) {
 			ReportError("Deleting project", err)
 			return
 		}
-		DeleteApiModel(p)
+		DeleteApiModel(projectModel{p})
 	}
 }
 
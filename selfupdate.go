@@ -0,0 +1,266 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+	version "github.com/mcuadros/go-version"
+)
+
+// RELEASES_URL is where `slyft self-update` downloads releases from, see
+// releaseURL for the layout.
+const RELEASES_URL = "https://s3-eu-west-1.amazonaws.com/io-slyft-releases"
+
+// Downloads larger than this are refused, and the new binary must
+// report its version within newBinaryTimeout.
+const (
+	maxReleaseSize   = 100 << 20
+	newBinaryTimeout = 10 * time.Second
+)
+
+// releaseArchive returns the name of the release archive of v for this
+// platform, e.g. slyft-0.4.0-linux-amd64.zip.
+func releaseArchive(v string) string {
+	return fmt.Sprintf("slyft-%s-%s-%s.zip", v, runtime.GOOS, runtime.GOARCH)
+}
+
+// releaseURL returns the URL of file of release v. Each release is a
+// directory below the update-url setting, containing the archives, their
+// checksums in SHA256SUMS (as written by sha256sum) and the Ed25519
+// signature of the checksums in SHA256SUMS.sig.
+func releaseURL(v, file string) string {
+	base := currentSettings().UpdateURL
+	if base == "" {
+		base = RELEASES_URL
+	}
+	return strings.TrimSuffix(base, "/") + "/" + path.Join(v, file)
+}
+
+func download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Downloading %s failed with status %d", url, resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxReleaseSize))
+	if err != nil {
+		return nil, fmt.Errorf("Downloading %s failed: %s", url, err)
+	}
+	return b, nil
+}
+
+// releaseChecksum returns the SHA-256 of file listed in sums.
+func releaseChecksum(sums []byte, file string) (string, error) {
+	for _, line := range strings.Split(string(sums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == file {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("There is no %s in this release", file)
+}
+
+// fetchRelease downloads the archive of release v for this platform. The
+// checksums of the release must be signed with signingPublicKey, and the
+// archive must match its checksum.
+func fetchRelease(ctx context.Context, v string) ([]byte, error) {
+	sums, err := download(ctx, releaseURL(v, "SHA256SUMS"))
+	if err != nil {
+		return nil, err
+	}
+	sig, err := download(ctx, releaseURL(v, "SHA256SUMS.sig"))
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(signingPublicKey, sums, sig); err != nil {
+		return nil, fmt.Errorf("Checksums of release %s are not signed by the slyft team: %s", v, err)
+	}
+
+	name := releaseArchive(v)
+	want, err := releaseChecksum(sums, name)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := download(ctx, releaseURL(v, name))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(archive)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return nil, fmt.Errorf("Checksum mismatch for %s: expected %s, got %s", name, want, got)
+	}
+	return archive, nil
+}
+
+// extractBinary returns the slyft binary from a release archive.
+func extractBinary(archive []byte) ([]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+	name := "slyft"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	for _, f := range r.File {
+		if path.Base(f.Name) != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(io.LimitReader(rc, maxReleaseSize))
+	}
+	return nil, fmt.Errorf("There is no %s in the archive", name)
+}
+
+// replaceExecutable replaces the file exe with binary. The old file is kept
+// as exe.old until check accepts the new one, and restored if it does not.
+func replaceExecutable(exe string, binary []byte, check func(string) error) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	// the new file is written next to exe, so that renaming is atomic
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), filepath.Base(exe)+".new")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(binary)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), info.Mode().Perm()|0111)
+	}
+	if err != nil {
+		return err
+	}
+
+	old := exe + ".old"
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		if rerr := os.Rename(old, exe); rerr != nil {
+			return fmt.Errorf("%s, and restoring %s failed: %s", err, exe, rerr)
+		}
+		return err
+	}
+	if err := check(exe); err != nil {
+		if rerr := os.Rename(old, exe); rerr != nil {
+			return fmt.Errorf("New version does not work (%s), and restoring %s failed: %s", err, exe, rerr)
+		}
+		return fmt.Errorf("New version does not work, kept the current one: %s", err)
+	}
+	// a running executable cannot be removed on Windows
+	if err := os.Remove(old); err != nil {
+		Log.Debugf("Unable to remove %s: %s", old, err)
+	}
+	return nil
+}
+
+// reportsVersion returns a check for replaceExecutable that the binary
+// starts and reports version v.
+func reportsVersion(v string) func(string) error {
+	return func(exe string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), newBinaryTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, exe, "--version")
+		cmd.Env = append(os.Environ(), "SLYFT_NO_UPDATE_CHECK=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return err
+		}
+		if !hasVersion(string(out), v) {
+			return fmt.Errorf("Expected version %s, got %s", v, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+}
+
+// hasVersion reports whether the output of `slyft --version` names version
+// v, e.g. "0.4.1" or "v0.4.1" but not "0.4.10".
+func hasVersion(out, v string) bool {
+	for _, f := range strings.Fields(out) {
+		if strings.TrimPrefix(f, "v") == strings.TrimPrefix(v, "v") {
+			return true
+		}
+	}
+	return false
+}
+
+// selfUpdate is registered without withBackend, so that it works even if
+// this version is refused by the update check.
+func selfUpdate(cmd *cli.Cmd) {
+	cmd.Spec = "[--force] [VERSION]"
+	force := cmd.BoolOpt("force f", false, "Install VERSION even if it is not newer")
+	target := cmd.StringArg("VERSION", "", "Version to install (default: the latest)")
+
+	cmd.Action = func() {
+		ctx := requestContext()
+		v := *target
+		if v == "" {
+			config, err := latestConfigJson(ctx)
+			if err != nil {
+				ReportError("Looking up the latest version", err)
+				cli.Exit(1)
+			}
+			v = config.ClientVersion.Latest
+		}
+		if !*force && !version.Compare(VERSION, v, "<") {
+			fmt.Printf("slyft %s is up to date\n", VERSION)
+			return
+		}
+
+		exe, err := os.Executable()
+		if err == nil {
+			exe, err = filepath.EvalSymlinks(exe)
+		}
+		if err != nil {
+			ReportError("Locating the slyft binary", err)
+			cli.Exit(1)
+		}
+		fmt.Printf("Downloading slyft %s for %s/%s\n", v, runtime.GOOS, runtime.GOARCH)
+		archive, err := fetchRelease(ctx, v)
+		if err != nil {
+			ReportError("Downloading the release", err)
+			cli.Exit(1)
+		}
+		binary, err := extractBinary(archive)
+		if err != nil {
+			ReportError("Unpacking the release", err)
+			cli.Exit(1)
+		}
+		if err := replaceExecutable(exe, binary, reportsVersion(v)); err != nil {
+			ReportError("Replacing "+exe, err)
+			cli.Exit(1)
+		}
+		fmt.Printf("Updated slyft from %s to %s\n", VERSION, v)
+	}
+}
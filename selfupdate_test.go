@@ -0,0 +1,142 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// withSigningKey replaces signingPublicKey with that of a new key, which it
+// returns for signing.
+func withSigningKey(t *testing.T) (ed25519.PrivateKey, func()) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	old := signingPublicKey
+	signingPublicKey = base64.StdEncoding.EncodeToString(der)
+	return key, func() { signingPublicKey = old }
+}
+
+// writeRelease puts a release of v with binary into dir, signed with key.
+func writeRelease(t *testing.T, dir, v string, binary []byte, key ed25519.PrivateKey) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	name := "slyft"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	w, _ := zw.Create(name)
+	w.Write(binary)
+	zw.Close()
+
+	sum := sha256.Sum256(archive.Bytes())
+	sums := []byte(fmt.Sprintf("%x  %s\n", sum, releaseArchive(v)))
+	files := map[string][]byte{
+		releaseArchive(v): archive.Bytes(),
+		"SHA256SUMS":      sums,
+		"SHA256SUMS.sig":  ed25519.Sign(key, sums),
+	}
+	os.MkdirAll(filepath.Join(dir, v), 0755)
+	for name, b := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, v, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFetchRelease(t *testing.T) {
+	defer withTempHome(t)()
+	dir, _ := ioutil.TempDir("", "slyft-releases")
+	defer os.RemoveAll(dir)
+	ts := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer ts.Close()
+	os.Setenv("SLYFT_UPDATE_URL", ts.URL)
+	defer os.Unsetenv("SLYFT_UPDATE_URL")
+
+	key, restore := withSigningKey(t)
+	defer restore()
+
+	writeRelease(t, dir, "0.4.0", []byte("new slyft"), key)
+	archive, err := fetchRelease(context.Background(), "0.4.0")
+	if err != nil {
+		t.Fatalf("Must fetch signed release: %v", err)
+	}
+	if b, err := extractBinary(archive); err != nil || string(b) != "new slyft" {
+		t.Errorf("Unexpected binary %q %v", b, err)
+	}
+
+	// the archive must match the signed checksum
+	ioutil.WriteFile(filepath.Join(dir, "0.4.0", releaseArchive("0.4.0")), []byte("tampered"), 0644)
+	if _, err := fetchRelease(context.Background(), "0.4.0"); err == nil {
+		t.Error("Must refuse archive with wrong checksum")
+	}
+
+	// and the checksums must be signed with the embedded key
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	writeRelease(t, dir, "0.4.1", []byte("new slyft"), otherKey)
+	if _, err := fetchRelease(context.Background(), "0.4.1"); err == nil {
+		t.Error("Must refuse release signed with another key")
+	}
+
+	if _, err := fetchRelease(context.Background(), "0.5.0"); err == nil {
+		t.Error("Must fail for missing release")
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "slyft-bin")
+	defer os.RemoveAll(dir)
+	exe := filepath.Join(dir, "slyft")
+	ioutil.WriteFile(exe, []byte("old"), 0755)
+
+	// a binary that fails the check is rolled back
+	err := replaceExecutable(exe, []byte("broken"), func(string) error { return errors.New("does not start") })
+	if b, _ := ioutil.ReadFile(exe); err == nil || string(b) != "old" {
+		t.Errorf("Must restore old binary, got %q %v", b, err)
+	}
+
+	err = replaceExecutable(exe, []byte("new"), func(string) error { return nil })
+	if b, _ := ioutil.ReadFile(exe); err != nil || string(b) != "new" {
+		t.Errorf("Must install new binary, got %q %v", b, err)
+	}
+	if info, _ := os.Stat(exe); info.Mode().Perm()&0100 == 0 {
+		t.Errorf("New binary must be executable, got %v", info.Mode())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Must clean up, got %d files", len(files))
+	}
+}
+
+func TestHasVersion(t *testing.T) {
+	for _, tc := range []struct {
+		out  string
+		want bool
+	}{
+		{"0.4.1\n", true},
+		{"v0.4.1\n", true},
+		{"slyft 0.4.1", true},
+		{"0.4.10\n", false},
+		{"10.4.1\n", false},
+		{"", false},
+	} {
+		if got := hasVersion(tc.out, "0.4.1"); got != tc.want {
+			t.Errorf("%q: expected %v, got %v", tc.out, tc.want, got)
+		}
+	}
+}
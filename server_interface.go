@@ -1,23 +1,198 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/thingforward/slyft-cli/slyft"
 )
 
-func Do(resource, method string, params interface{}) (*http.Response, error) {
-	b := new(bytes.Buffer)
-	json.NewEncoder(b).Encode(params)
-	req, err := http.NewRequest(method, ServerURL(resource), b)
+var apiClient *slyft.Client
+var sharedHTTPClient *http.Client
+
+// request timeout given on the command line, see main()
+var fTimeout *int
+var timeoutSet bool
+
+// print a trace of every request (--trace), see main()
+var fTrace *bool
+
+// connection settings given on the command line, see main()
+var fCAFile, fClientCert, fClientKey, fProxy *string
+var fInsecure *bool
+
+// files given by --record/--replay, see main()
+var fRecord, fReplay *string
+
+// retry settings given on the command line, see main()
+var fRetryAttempts, fRetryTimeout *int
+var retryAttemptsSet, retryTimeoutSet bool
+
+// API returns the client for the configured backend. Credentials are read
+// from the config file on every authenticated request.
+func API() *slyft.Client {
+	if apiClient == nil {
+		var auth slyft.AuthSource = configAuth{}
+		if replaying() {
+			auth = replayAuth{}
+		}
+		apiClient = slyft.NewClient(backendURL(), httpClient(), auth)
+		apiClient.Retry = retryPolicy()
+		apiClient.APIVersion = apiVersion
+	}
+	return apiClient
+}
+
+// httpClient returns the client used for all outgoing requests, i.e. API
+// calls, the update check and the terms download.
+func httpClient() *http.Client {
+	if sharedHTTPClient == nil {
+		sharedHTTPClient = &http.Client{Timeout: slyft.DefaultTimeout}
+	}
+	return sharedHTTPClient
+}
+
+// setupHTTPClient configures TLS and proxy of the shared http.Client from
+// the config file and command line flags (which take precedence).
+func setupHTTPClient() error {
+	var o slyft.TransportOptions
+	timeout := slyft.DefaultTimeout
+	s := currentSettings()
+	if s.Timeout != nil {
+		timeout = time.Duration(*s.Timeout) * time.Second
+	}
+	o = slyft.TransportOptions{
+		CAFile:   s.CAFile,
+		CertFile: s.ClientCert,
+		KeyFile:  s.ClientKey,
+		Proxy:    s.Proxy,
+		Insecure: s.Insecure,
+	}
+	overrideString(&o.CAFile, fCAFile)
+	overrideString(&o.CertFile, fClientCert)
+	overrideString(&o.KeyFile, fClientKey)
+	overrideString(&o.Proxy, fProxy)
+	if fInsecure != nil && *fInsecure {
+		o.Insecure = true
+	}
+	if timeoutSet && fTimeout != nil {
+		timeout = time.Duration(*fTimeout) * time.Second
+	}
+	Log.Debugf("transport options=%+v, timeout=%v", o, timeout)
+
+	if o.Insecure {
+		fmt.Fprintln(os.Stderr, "WARNING: TLS certificate verification is disabled (--insecure). Your connection")
+		fmt.Fprintln(os.Stderr, "WARNING: to the backend, including your credentials, is open to interception.")
+	}
 
+	t, err := slyft.NewTransport(o)
 	if err != nil {
-		Log.Critical("Failed to create a request: " + err.Error())
-		return nil, err
+		return err
+	}
+
+	var rt http.RoundTripper = t
+	switch {
+	case fRecord != nil && *fRecord != "" && replaying():
+		return errors.New("--record and --replay cannot be combined")
+	case replaying():
+		Log.Debugf("Replaying API traffic from %s", *fReplay)
+		if rt, err = slyft.NewReplayer(*fReplay); err != nil {
+			return err
+		}
+	case fRecord != nil && *fRecord != "":
+		Log.Debugf("Recording API traffic to %s", *fRecord)
+		rt = slyft.NewRecorder(*fRecord, t)
+	}
+
+	if fTrace != nil && *fTrace {
+		rt = slyft.NewTracer(rt, os.Stderr)
+	}
+
+	sharedHTTPClient = &http.Client{Transport: rt, Timeout: timeout}
+	apiClient = nil
+	return nil
+}
+
+// replaying reports whether responses are served from a cassette (--replay).
+func replaying() bool {
+	return fReplay != nil && *fReplay != ""
+}
+
+func overrideString(s *string, flag *string) {
+	if flag != nil && *flag != "" {
+		*s = *flag
+	}
+}
+
+// retryPolicy returns the default retry policy, adjusted by the settings in
+// the config file, which in turn are overridden by command line flags.
+func retryPolicy() *slyft.RetryPolicy {
+	p := slyft.DefaultRetryPolicy()
+	s := currentSettings()
+	if s.RetryAttempts > 0 {
+		p.MaxAttempts = s.RetryAttempts
 	}
+	if s.RetryTimeout != nil {
+		p.Timeout = time.Duration(*s.RetryTimeout) * time.Second
+	}
+	if retryAttemptsSet && fRetryAttempts != nil {
+		p.MaxAttempts = *fRetryAttempts
+	}
+	if retryTimeoutSet && fRetryTimeout != nil {
+		p.Timeout = time.Duration(*fRetryTimeout) * time.Second
+	}
+	Log.Debugf("retry policy=%+v", p)
+	return p
+}
+
+// exit code after SIGINT/SIGTERM, as used by shells
+const exitInterrupted = 130
+
+// time given to a command to wind down after an interrupt
+const interruptGracePeriod = 3 * time.Second
+
+var rootCtx, cancelRoot = context.WithCancel(context.Background())
+
+// requestContext returns the context for API calls of a command. It is
+// cancelled on SIGINT/SIGTERM, see handleSignals.
+func requestContext() context.Context {
+	return rootCtx
+}
+
+// handleSignals cancels in-flight requests and wait loops on the first
+// SIGINT/SIGTERM. The process exits when the command has wound down, after
+// a grace period or on a second signal, whichever comes first.
+func handleSignals() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		fmt.Fprintln(os.Stderr, "\nInterrupted, cancelling...")
+		cancelRoot()
+		select {
+		case <-sigs:
+		case <-time.After(interruptGracePeriod):
+		}
+		os.Exit(exitInterrupted)
+	}()
+}
 
+// interrupted reports whether the command was cancelled by a signal.
+func interrupted() bool {
+	return rootCtx.Err() != nil
+}
+
+// configAuth reads the credentials from the config file and stores the
+// credentials rotated by the backend there.
+type configAuth struct{}
+
+func (configAuth) Auth() (*slyft.Auth, error) {
 	auth, err := readAuthFromConfig()
 	if err != nil {
 		fmt.Println("You do not seem to be logged in. Please do a `slyft user login`")
@@ -25,49 +200,75 @@ func Do(resource, method string, params interface{}) (*http.Response, error) {
 	}
 	if !auth.GoodForLogin() {
 		fmt.Println("You do not seem to be logged in. Please do a `slyft user login`")
-		return nil, errors.New("Not logged in.")
+		return nil, slyft.ErrNotLoggedIn
 	}
+	return &slyft.Auth{
+		AccessToken: auth.AccessToken,
+		Client:      auth.Client,
+		Uid:         auth.Uid,
+		Expiry:      auth.Expiry,
+	}, nil
+}
 
-	addAuthToHeader(&req.Header, auth)
-	req.Header.Add("Content-Type", "application/json; charset=utf-8")
-	client := &http.Client{}
-
-	//Log.Debugf("auth=%#v", auth)
-	Log.Debugf("req=%#v", req)
+func (configAuth) UpdateAuth(used, updated *slyft.Auth) error {
+	return updateAuth(func(stored *SlyftAuth) bool {
+		if stored.Client != used.Client || stored.Uid != used.Uid {
+			// logged out or logged in again meanwhile
+			return false
+		}
+		if stored.AccessToken != used.AccessToken && updated.Expiry <= stored.Expiry {
+			// another process already stored newer credentials
+			return false
+		}
+		*stored = SlyftAuth{
+			AccessToken: updated.AccessToken,
+			Client:      updated.Client,
+			Uid:         updated.Uid,
+			Expiry:      updated.Expiry,
+		}
+		return true
+	})
+}
 
-	resp, err := client.Do(req)
-	Log.Debugf("resp=%#v", resp)
+// the time of the last successful call is written at most this often
+const lastUsedInterval = time.Minute
 
+func (configAuth) AuthUsed(a *slyft.Auth, at time.Time) {
+	if replaying() {
+		return
+	}
+	sr, _ := readConfig()
+	profile := sr.profileName()
+	if at.Unix()-sr.LastUsed[profile] < int64(lastUsedInterval/time.Second) {
+		return
+	}
+	err := updateConfig(func(sr *SlyftRC) bool {
+		if sr.LastUsed == nil {
+			sr.LastUsed = map[string]int64{}
+		}
+		sr.LastUsed[profile] = at.Unix()
+		return true
+	})
 	if err != nil {
-		Log.Debugf("err=%#v", err)
+		Log.Debugf("Unable to store time of last call: %s", err)
 	}
-
-	return resp, err
 }
 
-func DoNoAuth(resource, method string, params interface{}) (*http.Response, error) {
-	b := new(bytes.Buffer)
-	json.NewEncoder(b).Encode(params)
-	req, err := http.NewRequest(method, ServerURL(resource), b)
+// replayAuth authenticates replayed requests. Recorded credentials are
+// redacted, so any credentials will do; rotated ones are not stored.
+type replayAuth struct{}
 
-	if err != nil {
-		Log.Critical("Failed to create a request: " + err.Error())
-		return nil, err
+func (replayAuth) Auth() (*slyft.Auth, error) {
+	if auth, err := readAuthFromConfig(); err == nil && auth.GoodForLogin() {
+		return &slyft.Auth{AccessToken: auth.AccessToken, Client: auth.Client, Uid: auth.Uid}, nil
 	}
-
-	req.Header.Add("Content-Type", "application/json; charset=utf-8")
-	Log.Debugf("req=%#v", req)
-	Log.Debugf("b=%#v", b)
-	client := &http.Client{}
-	return client.Do(req)
+	return &slyft.Auth{AccessToken: slyft.Redacted, Client: slyft.Redacted, Uid: slyft.Redacted}, nil
 }
 
-func addAuthToHeader(hdr *http.Header, s *SlyftAuth) {
-	hdr.Add("access-token", s.AccessToken)
-	hdr.Add("client", s.Client)
-	hdr.Add("uid", s.Uid)
+func Do(resource, method string, params interface{}) (*http.Response, error) {
+	return API().Call(requestContext(), method, resource, params)
 }
 
-func ServerURL(endpoint string) string {
-	return BackendBaseUrl + endpoint
+func DoNoAuth(resource, method string, params interface{}) (*http.Response, error) {
+	return API().CallNoAuth(requestContext(), method, resource, params)
 }
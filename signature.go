@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+)
+
+// signingPublicKey verifies the signatures of releases and of the config
+// JSON, see fetchRelease and getConfigJson. It is the base64 encoded
+// (PKIX, DER) Ed25519 public key of the release maintainers, who keep the
+// private key. Release builds set it with -ldflags "-X
+// main.signingPublicKey=...", see README.md ("Signing releases"). Builds
+// without it can neither self-update nor check for updates. Tests replace
+// it with their own key.
+var signingPublicKey = ""
+
+// errNoSigningKey is returned for builds without signingPublicKey, and
+// errUnverified wraps all errors verifying the config JSON.
+var (
+	errNoSigningKey = errors.New("This build has no release signing key, please install an official release")
+	errUnverified   = errors.New("could not be verified")
+)
+
+// verifySignature checks that sig is the raw Ed25519 signature of data for
+// the base64 encoded public key.
+func verifySignature(publicKey string, data, sig []byte) error {
+	if publicKey == "" {
+		return errNoSigningKey
+	}
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return errors.New("Invalid public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return errors.New("Public key is not an Ed25519 key")
+	}
+	if !ed25519.Verify(pub, data, sig) {
+		return errors.New("Invalid signature")
+	}
+	return nil
+}
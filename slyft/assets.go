@@ -0,0 +1,104 @@
+package slyft
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type Asset struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	ProjectId   int       `json:"project_id"`
+	ProjectName string    `json:"project_name"`
+	Origin      string    `json:"origin"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Path returns the resource path of the asset in API version 1. Use
+// ResourcePath for the API version of a client.
+func (a *Asset) Path() string {
+	return "/v1" + a.ResourcePath()
+}
+
+// ResourcePath returns the resource path of the asset relative to the API
+// version, see Client.APIPath.
+func (a *Asset) ResourcePath() string {
+	return fmt.Sprintf("/projects/%d/assets/%d", a.ProjectId, a.ID)
+}
+
+type AssetPost struct {
+	Name  string `json:"name"`
+	Asset string `json:"asset"` // note: this will be base64 string
+}
+
+type AssetParam struct {
+	Asset AssetPost `json:"asset"`
+}
+
+type AssetNameString struct {
+	AssetNameString string `json:"asset_name"`
+}
+
+// AssetsService handles the asset resources of projects.
+type AssetsService struct {
+	client *Client
+}
+
+// List returns the assets of a project.
+func (s *AssetsService) List(ctx context.Context, projectID int) ([]Asset, error) {
+	return s.list(ctx, projectPath(projectID)+"/assets")
+}
+
+// ListAll returns the assets of all projects of the user.
+func (s *AssetsService) ListAll(ctx context.Context) ([]Asset, error) {
+	return s.list(ctx, "/assets")
+}
+
+func (s *AssetsService) list(ctx context.Context, resource string) ([]Asset, error) {
+	assets := make([]Asset, 0)
+	if err := s.client.call(ctx, "GET", s.client.APIPath(resource), nil, http.StatusOK, &assets); err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+// Upload adds content as asset name to a project. mimeType describes the
+// content, e.g. "application/json" or "application/x-yaml".
+func (s *AssetsService) Upload(ctx context.Context, projectID int, name string, content []byte, mimeType string) (*Asset, error) {
+	param := &AssetParam{
+		AssetPost{
+			Name:  name,
+			Asset: "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(content),
+		},
+	}
+	a := &Asset{}
+	if err := s.client.call(ctx, "POST", s.client.APIPath(projectPath(projectID)+"/assets"), param, http.StatusCreated, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Download streams the content of asset name of a project to w.
+func (s *AssetsService) Download(ctx context.Context, projectID int, name string, w io.Writer) error {
+	resp, err := s.client.Call(ctx, "GET", s.client.APIPath(projectPath(projectID)+"/assetstore"), &AssetNameString{name})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := CheckResponse(resp, http.StatusOK); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Delete removes an asset from its project.
+func (s *AssetsService) Delete(ctx context.Context, a *Asset) error {
+	return s.client.call(ctx, "DELETE", s.client.APIPath(a.ResourcePath()), &AssetNameString{a.Name}, http.StatusNoContent, nil)
+}
@@ -0,0 +1,96 @@
+package slyft
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Auth holds the devise_token_auth credentials of a session.
+type Auth struct {
+	AccessToken string
+	Client      string
+	Uid         string
+	// Expiry of the access token in seconds since the epoch (0: unknown)
+	Expiry int64
+}
+
+// Valid reports whether all parts of the credentials are present.
+func (a *Auth) Valid() bool {
+	return a != nil && a.AccessToken != "" && a.Client != "" && a.Uid != ""
+}
+
+// Expired reports whether the access token is known to be expired.
+func (a *Auth) Expired() bool {
+	return a.Expiry > 0 && time.Now().Unix() >= a.Expiry
+}
+
+// AuthFromHeader extracts the credentials sent by the backend in the
+// access-token, client, uid and expiry headers.
+func AuthFromHeader(hdr http.Header) Auth {
+	expiry, _ := strconv.ParseInt(hdr.Get("expiry"), 10, 64)
+	return Auth{
+		AccessToken: hdr.Get("access-token"),
+		Client:      hdr.Get("client"),
+		Uid:         hdr.Get("uid"),
+		Expiry:      expiry,
+	}
+}
+
+func addAuthToHeader(hdr http.Header, a *Auth) {
+	hdr.Add("access-token", a.AccessToken)
+	hdr.Add("client", a.Client)
+	hdr.Add("uid", a.Uid)
+}
+
+// AuthSource supplies the credentials for authenticated requests.
+type AuthSource interface {
+	Auth() (*Auth, error)
+}
+
+// AuthUpdater is implemented by AuthSources that persist credentials. The
+// backend may rotate the access token with every response; UpdateAuth is
+// then called with the credentials used for the request and the new ones.
+type AuthUpdater interface {
+	UpdateAuth(used, updated *Auth) error
+}
+
+// AuthUseRecorder is implemented by AuthSources that keep track of when
+// their credentials were last accepted by the backend. AuthUsed is called
+// after every successful authenticated request.
+type AuthUseRecorder interface {
+	AuthUsed(a *Auth, at time.Time)
+}
+
+// AuthSourceFunc adapts a function to the AuthSource interface.
+type AuthSourceFunc func() (*Auth, error)
+
+func (f AuthSourceFunc) Auth() (*Auth, error) {
+	return f()
+}
+
+// StaticAuth returns an AuthSource that always yields the given credentials.
+func StaticAuth(a Auth) AuthSource {
+	return AuthSourceFunc(func() (*Auth, error) {
+		return &a, nil
+	})
+}
+
+// rotatedAuth returns the credentials from the headers of resp if they
+// differ from the ones used for the request, and nil otherwise.
+func rotatedAuth(used *Auth, resp *http.Response) *Auth {
+	updated := AuthFromHeader(resp.Header)
+	if updated.AccessToken == "" {
+		return nil
+	}
+	if updated.AccessToken == used.AccessToken && (updated.Expiry == 0 || updated.Expiry == used.Expiry) {
+		return nil
+	}
+	if updated.Client == "" {
+		updated.Client = used.Client
+	}
+	if updated.Uid == "" {
+		updated.Uid = used.Uid
+	}
+	return &updated
+}
@@ -0,0 +1,264 @@
+package slyft
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Redacted replaces credentials in recorded interactions.
+const Redacted = "REDACTED"
+
+// headers and JSON body fields that carry credentials
+var (
+	sensitiveHeaders = []string{"access-token", "client", "uid", "Authorization", "Cookie", "Set-Cookie"}
+	sensitiveFields  = []string{"password", "password_confirmation", "current_password", "access_token", "client", "uid"}
+)
+
+// Interaction is a recorded request/response pair.
+type Interaction struct {
+	Request  RecordedMessage `json:"request"`
+	Response RecordedMessage `json:"response"`
+}
+
+// RecordedMessage holds a request or a response. Bodies that are not valid
+// UTF-8 are stored base64 encoded in BodyBase64.
+type RecordedMessage struct {
+	Method     string      `json:"method,omitempty"`
+	URL        string      `json:"url,omitempty"`
+	StatusCode int         `json:"status_code,omitempty"`
+	Status     string      `json:"status,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"body_base64,omitempty"`
+}
+
+func (m *RecordedMessage) setBody(b []byte) {
+	if utf8.Valid(b) {
+		m.Body = string(b)
+	} else {
+		m.BodyBase64 = base64.StdEncoding.EncodeToString(b)
+	}
+}
+
+func (m *RecordedMessage) body() []byte {
+	if m.BodyBase64 != "" {
+		b, _ := base64.StdEncoding.DecodeString(m.BodyBase64)
+		return b
+	}
+	return []byte(m.Body)
+}
+
+// Cassette is a sequence of interactions, stored as JSON file.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// LoadCassette reads a cassette file.
+func LoadCassette(file string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("Invalid cassette %s: %s", file, err)
+	}
+	return c, nil
+}
+
+// Save writes the cassette to file.
+func (c *Cassette) Save(file string) error {
+	b, err := json.MarshalIndent(c, "", "	")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0600)
+}
+
+// Recorder is an http.RoundTripper that passes requests on to Transport and
+// records every interaction, with credentials redacted, into File. The file
+// is rewritten after each interaction.
+type Recorder struct {
+	Transport http.RoundTripper
+	File      string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder returns a Recorder writing to file. If transport is nil,
+// http.DefaultTransport is used.
+func NewRecorder(file string, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{Transport: transport, File: file}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = b
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	in := Interaction{
+		Request: RecordedMessage{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: redactHeader(req.Header),
+		},
+		Response: RecordedMessage{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     redactHeader(resp.Header),
+		},
+	}
+	in.Request.setBody(redactBody(reqBody))
+	in.Response.setBody(redactBody(respBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	if err := r.cassette.Save(r.File); err != nil {
+		log.Warningf("Unable to write cassette %s: %s", r.File, err)
+	}
+	return resp, nil
+}
+
+// Replayer is an http.RoundTripper that answers requests from a cassette
+// instead of the network. Each recorded interaction is used once, in order,
+// for the next request with the same method and URL.
+type Replayer struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// NewReplayer returns a Replayer for the cassette in file.
+func NewReplayer(file string) (*Replayer, error) {
+	c, err := LoadCassette(file)
+	if err != nil {
+		return nil, err
+	}
+	return &Replayer{cassette: c, used: make([]bool, len(c.Interactions))}, nil
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, in := range r.cassette.Interactions {
+		if r.used[i] || in.Request.Method != req.Method || in.Request.URL != req.URL.String() {
+			continue
+		}
+		r.used[i] = true
+		body := in.Response.body()
+		header := http.Header{}
+		for k, v := range in.Response.Header {
+			header[k] = v
+		}
+		return &http.Response{
+			StatusCode:    in.Response.StatusCode,
+			Status:        in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, errors.New("No recorded interaction left for " + req.Method + " " + req.URL.String())
+}
+
+func redactHeader(h http.Header) http.Header {
+	redacted := http.Header{}
+	for k, v := range h {
+		redacted[k] = v
+	}
+	for _, k := range sensitiveHeaders {
+		if redacted.Get(k) != "" {
+			redacted.Set(k, Redacted)
+		}
+	}
+	return redacted
+}
+
+// redactBody replaces credentials in JSON bodies. Other bodies are returned
+// unchanged.
+func redactBody(b []byte) []byte {
+	var v interface{}
+	if len(b) == 0 || json.Unmarshal(b, &v) != nil {
+		return b
+	}
+	if !redactValue(v) {
+		return b
+	}
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return b
+	}
+	return redacted
+}
+
+// redactValue redacts sensitive fields in decoded JSON and reports whether
+// anything was changed.
+func redactValue(v interface{}) bool {
+	changed := false
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, field := range t {
+			if isSensitiveField(k) {
+				if _, ok := field.(string); ok {
+					t[k] = Redacted
+					changed = true
+					continue
+				}
+			}
+			changed = redactValue(field) || changed
+		}
+	case []interface{}:
+		for _, e := range t {
+			changed = redactValue(e) || changed
+		}
+	}
+	return changed
+}
+
+func isSensitiveField(name string) bool {
+	for _, f := range sensitiveFields {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	return false
+}
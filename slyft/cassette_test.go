@@ -0,0 +1,70 @@
+package slyft
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("access-token", "rotated-secret")
+		w.Write([]byte(`[{"id": 1, "name": "recorded"}]`))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "slyft-cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "cassette.json")
+
+	c := NewClient(ts.URL, &http.Client{Transport: NewRecorder(file, nil)}, StaticAuth(testAuth))
+	if _, err := c.Projects.Create(context.Background(), "foo", ""); err == nil {
+		t.Error("Expected unexpected status for create")
+	}
+	if _, err := c.Projects.List(context.Background()); err != nil {
+		t.Fatalf("Must list projects while recording: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Must write cassette: %v", err)
+	}
+	for _, secret := range []string{testAuth.AccessToken, testAuth.Client, testAuth.Uid, "rotated-secret"} {
+		if strings.Contains(string(b), `"`+secret+`"`) {
+			t.Errorf("Cassette must not contain %s:\n%s", secret, b)
+		}
+	}
+	ts.Close()
+
+	replayer, err := NewReplayer(file)
+	if err != nil {
+		t.Fatalf("Must load cassette: %v", err)
+	}
+	c = NewClient(ts.URL, &http.Client{Transport: replayer}, StaticAuth(testAuth))
+	c.Retry = nil
+	projects, err := c.Projects.List(context.Background())
+	if err != nil || len(projects) != 1 || projects[0].Name != "recorded" {
+		t.Errorf("Must replay projects, got %+v (%v)", projects, err)
+	}
+	if _, err := c.Projects.List(context.Background()); err == nil {
+		t.Error("Must fail when the cassette is exhausted")
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	body := redactBody([]byte(`{"email": "foo@bar.boo", "password": "secret", "nested": [{"password_confirmation": "secret"}]}`))
+	if strings.Contains(string(body), "secret") || !strings.Contains(string(body), "foo@bar.boo") {
+		t.Errorf("Unexpected redaction: %s", body)
+	}
+	if string(redactBody([]byte("not json"))) != "not json" {
+		t.Error("Must leave non-JSON bodies unchanged")
+	}
+}
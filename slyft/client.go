@@ -0,0 +1,195 @@
+// Package slyft is a client library for the Slyft API. It is used by the
+// slyft command line client, but can be imported by any Go program that
+// needs to talk to a Slyft backend.
+//
+//	c := slyft.NewClient("https://api.slyft.io/", nil, slyft.StaticAuth(auth))
+//	projects, err := c.Projects.List(ctx)
+//
+// Requests go to the API version in Client.APIVersion, see
+// NegotiateAPIVersion. The Path methods of resources return API version 1
+// paths as they always did; ResourcePath and Client.APIPath give the path
+// for the version of a client.
+package slyft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+const DefaultBaseURL = "https://api.slyft.io/"
+
+// DefaultTimeout limits a single request of clients created by NewClient.
+const DefaultTimeout = 30 * time.Second
+
+var log = logging.MustGetLogger("slyft")
+
+// Client talks to a Slyft backend.
+type Client struct {
+	// BaseURL of the backend, e.g. DefaultBaseURL.
+	BaseURL string
+	// HTTPClient used for all requests.
+	HTTPClient *http.Client
+	// AuthSource supplies credentials for authenticated requests.
+	AuthSource AuthSource
+	// Retry controls retries of transient failures; nil disables them.
+	Retry *RetryPolicy
+	// APIVersion of the resource paths, see NegotiateAPIVersion.
+	APIVersion int
+
+	Projects *ProjectsService
+	Assets   *AssetsService
+	Jobs     *JobsService
+}
+
+// NewClient returns a client for the backend at baseURL using the
+// DefaultRetryPolicy and MaxAPIVersion. If baseURL is empty,
+// DefaultBaseURL is used; if httpClient is nil, a new http.Client with
+// DefaultTimeout is created.
+func NewClient(baseURL string, httpClient *http.Client, auth AuthSource) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	c := &Client{
+		BaseURL:    baseURL,
+		HTTPClient: httpClient,
+		AuthSource: auth,
+		Retry:      DefaultRetryPolicy(),
+		APIVersion: MaxAPIVersion,
+	}
+	c.Projects = &ProjectsService{c}
+	c.Assets = &AssetsService{c}
+	c.Jobs = &JobsService{c}
+	return c
+}
+
+// APIPath returns the path of an API resource for the API version of the
+// client, e.g. "/v1/projects" for "/projects".
+func (c *Client) APIPath(resource string) string {
+	return fmt.Sprintf("/v%d%s", c.APIVersion, resource)
+}
+
+// URL returns the absolute URL of a resource path such as "/v1/projects".
+func (c *Client) URL(resource string) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + "/" + strings.TrimPrefix(resource, "/")
+}
+
+// NewRequest creates a request for resource with params encoded as JSON body.
+// The request is not authenticated.
+func (c *Client) NewRequest(ctx context.Context, method, resource string, params interface{}) (*http.Request, error) {
+	b := new(bytes.Buffer)
+	if params != nil {
+		if err := json.NewEncoder(b).Encode(params); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, c.URL(resource), b)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	return req, nil
+}
+
+// Call performs an authenticated request and returns the raw response.
+// The caller is responsible for closing the response body. If the backend
+// rotates the credentials and the AuthSource is an AuthUpdater, it is
+// handed the new credentials; an AuthUseRecorder is told about successful
+// requests.
+func (c *Client) Call(ctx context.Context, method, resource string, params interface{}) (*http.Response, error) {
+	req, err := c.NewRequest(ctx, method, resource, params)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := c.authenticate(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := c.AuthSource.(AuthUpdater); ok {
+		if updated := rotatedAuth(auth, resp); updated != nil {
+			log.Debugf("credentials rotated by backend, expiry=%d", updated.Expiry)
+			if err := u.UpdateAuth(auth, updated); err != nil {
+				log.Warningf("Unable to store updated credentials: %s", err)
+			}
+		}
+	}
+	if r, ok := c.AuthSource.(AuthUseRecorder); ok && resp.StatusCode < 400 {
+		r.AuthUsed(auth, time.Now())
+	}
+	return resp, nil
+}
+
+// CallNoAuth performs a request without credentials and returns the raw
+// response. The caller is responsible for closing the response body.
+func (c *Client) CallNoAuth(ctx context.Context, method, resource string, params interface{}) (*http.Response, error) {
+	req, err := c.NewRequest(ctx, method, resource, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(req)
+}
+
+func (c *Client) authenticate(req *http.Request) (*Auth, error) {
+	if c.AuthSource == nil {
+		return nil, ErrNotLoggedIn
+	}
+	auth, err := c.AuthSource.Auth()
+	if err != nil {
+		return nil, err
+	}
+	if !auth.Valid() {
+		return nil, ErrNotLoggedIn
+	}
+	addAuthToHeader(req.Header, auth)
+	return auth, nil
+}
+
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	log.Debugf("%s %s", req.Method, req.URL)
+	resp, err := c.doWithRetry(req)
+	if err != nil {
+		log.Debugf("err=%#v", err)
+		return nil, err
+	}
+	log.Debugf("status=%s", resp.Status)
+	return resp, nil
+}
+
+// call performs an authenticated request, checks for the expected status
+// code and decodes the JSON response into v (if v is not nil).
+func (c *Client) call(ctx context.Context, method, resource string, params interface{}, expectedCode int, v interface{}) error {
+	resp, err := c.Call(ctx, method, resource, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := CheckResponse(resp, expectedCode); err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	log.Debugf("body=%s", redactedBody(body))
+	return json.Unmarshal(body, v)
+}
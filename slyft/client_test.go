@@ -0,0 +1,156 @@
+package slyft
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testAuth = Auth{AccessToken: "token", Client: "client", Uid: "foo@bar.boo"}
+
+func TestClientURL(t *testing.T) {
+	for _, base := range []string{"http://localhost:3000", "http://localhost:3000/"} {
+		c := NewClient(base, nil, nil)
+		if u := c.URL("/v1/projects"); u != "http://localhost:3000/v1/projects" {
+			t.Errorf("Unexpected URL for base %s: %s", base, u)
+		}
+	}
+}
+
+func TestProjectsList(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/v1/projects" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("access-token") != testAuth.AccessToken || r.Header.Get("uid") != testAuth.Uid {
+			t.Errorf("Missing auth headers: %v", r.Header)
+		}
+		w.Write([]byte(`[{"id": 1, "name": "one"}, {"id": 2, "name": "two"}]`))
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, nil, StaticAuth(testAuth))
+	projects, err := c.Projects.List(context.Background())
+	if err != nil {
+		t.Fatalf("Must list projects: %v", err)
+	}
+	if len(projects) != 2 || projects[1].ID != 2 || projects[1].Name != "two" {
+		t.Errorf("Unexpected projects: %+v", projects)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, nil, StaticAuth(testAuth))
+	_, err := c.Jobs.Get(context.Background(), 1, 2)
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error, got %#v", err)
+	}
+	e := err.(*APIError)
+	if e.Method != "GET" || e.Endpoint != "/v1/projects/1/jobs/2" {
+		t.Errorf("Unexpected error details: %+v", e)
+	}
+}
+
+func TestNotLoggedIn(t *testing.T) {
+	c := NewClient("http://localhost:1", nil, StaticAuth(Auth{}))
+	if _, err := c.Projects.List(context.Background()); err != ErrNotLoggedIn {
+		t.Errorf("Expected ErrNotLoggedIn, got %v", err)
+	}
+}
+
+func TestParseErrorMessages(t *testing.T) {
+	cases := map[string][]string{
+		`{"success": false, "errors": ["Invalid login credentials."]}`:                                    {"Invalid login credentials."},
+		`{"status": "error", "errors": {"email": ["is invalid"], "full_messages": ["Email is invalid"]}}`: {"Email is invalid"},
+		`{"errors": {"name": ["can't be blank"], "details": ["is too long", "is weird"]}}`:                {"details is too long", "details is weird", "name can't be blank"},
+		`{"error": "Not found"}`: {"Not found"},
+		`{"errors": {"full_messages": "not a list"}, "message": "oops"}`: {"oops"},
+		`[1, 2, 3]`:                nil,
+		`<html>Bad Gateway</html>`: nil,
+	}
+	for body, expected := range cases {
+		msgs := parseErrorMessages([]byte(body))
+		if strings.Join(msgs, "|") != strings.Join(expected, "|") {
+			t.Errorf("For %s expected %v, got %v", body, expected, msgs)
+		}
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "abc")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"errors": ["Name has already been taken"]}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, nil, StaticAuth(testAuth))
+	_, err := c.Projects.Create(context.Background(), "foo", "")
+	e, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("Expected APIError, got %#v", err)
+	}
+	if e.StatusCode != http.StatusUnprocessableEntity || e.Method != "POST" || e.RequestID != "abc" {
+		t.Errorf("Unexpected error details: %+v", e)
+	}
+	if e.Error() != "Name has already been taken" {
+		t.Errorf("Unexpected error message: %s", e.Error())
+	}
+}
+
+type recordingAuth struct {
+	auth    Auth
+	updated *Auth
+}
+
+func (r *recordingAuth) Auth() (*Auth, error) {
+	return &r.auth, nil
+}
+
+func (r *recordingAuth) UpdateAuth(used, updated *Auth) error {
+	r.updated = updated
+	return nil
+}
+
+func TestRotatedAuth(t *testing.T) {
+	token := "token"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("access-token", token)
+		w.Header().Set("client", "client")
+		w.Header().Set("expiry", "1900000000")
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	src := &recordingAuth{auth: testAuth}
+	c := NewClient(ts.URL, nil, src)
+	c.Projects.List(context.Background())
+	if src.updated == nil || src.updated.Expiry != 1900000000 || src.updated.Uid != testAuth.Uid {
+		t.Errorf("Expected updated expiry, got %+v", src.updated)
+	}
+
+	token = "rotated"
+	src = &recordingAuth{auth: testAuth}
+	src.auth.Expiry = 1900000000
+	c = NewClient(ts.URL, nil, src)
+	c.Projects.List(context.Background())
+	if src.updated == nil || src.updated.AccessToken != "rotated" {
+		t.Errorf("Expected rotated token, got %+v", src.updated)
+	}
+
+	token = testAuth.AccessToken
+	src = &recordingAuth{auth: testAuth}
+	src.auth.Expiry = 1900000000
+	c = NewClient(ts.URL, nil, src)
+	c.Projects.List(context.Background())
+	if src.updated != nil {
+		t.Errorf("Must not update unchanged credentials, got %+v", src.updated)
+	}
+}
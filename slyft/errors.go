@@ -0,0 +1,146 @@
+package slyft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ErrNotLoggedIn is returned for authenticated requests when no valid
+// credentials are available.
+var ErrNotLoggedIn = errors.New("Not logged in.")
+
+// APIError is returned when the backend answers with an unexpected status
+// code. Messages holds the reasons given by the server, if any.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Method     string
+	Endpoint   string
+	Messages   []string
+	RequestID  string
+}
+
+// CheckResponse returns nil if the status code of resp is one of expected,
+// and an *APIError otherwise. In the latter case the response body is
+// consumed to extract the error messages.
+func CheckResponse(resp *http.Response, expected ...int) error {
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	log.Debugf("resp.Code=%#v / expected=%v", resp.StatusCode, expected)
+
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+	}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.Endpoint = resp.Request.URL.Path
+	}
+	if body, err := ioutil.ReadAll(resp.Body); err == nil {
+		log.Debugf("body=%s", redactedBody(body))
+		e.Messages = parseErrorMessages(body)
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	if len(e.Messages) > 0 {
+		return strings.Join(e.Messages, "; ")
+	}
+	if e.StatusCode == http.StatusUnauthorized {
+		return "Unauthorized, please log in first."
+	}
+	status := e.Status
+	if status == "" {
+		status = fmt.Sprintf("%d", e.StatusCode)
+	}
+	if e.Method == "" {
+		return fmt.Sprintf("Unexpected response from API: %s", status)
+	}
+	return fmt.Sprintf("Unexpected response from API: %s (%s %s)", status, e.Method, e.Endpoint)
+}
+
+// IsNotFound reports whether err is an APIError for a missing resource.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized reports whether err is an APIError for missing or invalid
+// credentials.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+func hasStatus(err error, code int) bool {
+	e, ok := err.(*APIError)
+	return ok && e.StatusCode == code
+}
+
+// parseErrorMessages extracts the error messages from the error bodies sent
+// by the backend. Known shapes are
+//
+//	{"errors": ["msg", ...]}
+//	{"errors": {"full_messages": ["msg", ...], "field": ["msg", ...]}}
+//	{"errors": {"field": ["msg", ...]}}
+//	{"error": "msg"}
+//	{"message": "msg"}
+//
+// Anything else yields no messages.
+func parseErrorMessages(body []byte) []string {
+	var f map[string]interface{}
+	if err := json.Unmarshal(body, &f); err != nil {
+		return nil
+	}
+
+	var msgs []string
+	switch e := f["errors"].(type) {
+	case []interface{}:
+		msgs = appendStrings(msgs, e, "")
+	case string:
+		msgs = append(msgs, e)
+	case map[string]interface{}:
+		if fm, ok := e["full_messages"].([]interface{}); ok {
+			msgs = appendStrings(msgs, fm, "")
+			break
+		}
+		fields := make([]string, 0, len(e))
+		for field := range e {
+			if field != "full_messages" {
+				fields = append(fields, field)
+			}
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			switch v := e[field].(type) {
+			case []interface{}:
+				msgs = appendStrings(msgs, v, field+" ")
+			case string:
+				msgs = append(msgs, field+" "+v)
+			}
+		}
+	}
+	for _, key := range []string{"error", "message"} {
+		if s, ok := f[key].(string); ok && s != "" {
+			msgs = append(msgs, s)
+		}
+	}
+	return msgs
+}
+
+func appendStrings(msgs []string, list []interface{}, prefix string) []string {
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			msgs = append(msgs, prefix+s)
+		}
+	}
+	return msgs
+}
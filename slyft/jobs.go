@@ -0,0 +1,127 @@
+package slyft
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type Job struct {
+	ID          int        `json:"id"`
+	Kind        string     `json:"kind"`
+	Status      string     `json:"status"`
+	Results     JobResults `json:"results"`
+	ProjectId   int        `json:"project_id"`
+	ProjectName string     `json:"project_name"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type JobResults struct {
+	ResultMessage string   `json:"resultMessage"`
+	ResultStatus  int      `json:"resultStatus"`
+	ResultAssets  []string `json:"resultAssets"`
+	ResultDetails []string `json:"resultDetails"`
+}
+
+// JobStatusProcessed is the status of a job that has finished.
+const JobStatusProcessed = "processed"
+
+// Path returns the resource path of the job in API version 1. Use
+// ResourcePath for the API version of a client.
+func (j *Job) Path() string {
+	return "/v1" + j.ResourcePath()
+}
+
+// ResourcePath returns the resource path of the job relative to the API
+// version, see Client.APIPath.
+func (j *Job) ResourcePath() string {
+	return jobPath(j.ProjectId, j.ID)
+}
+
+// Processed reports whether the job has finished.
+func (j *Job) Processed() bool {
+	return j.Status == JobStatusProcessed
+}
+
+func jobPath(projectID, jobID int) string {
+	return fmt.Sprintf("%s/jobs/%d", projectPath(projectID), jobID)
+}
+
+type JobParam struct {
+	Job Job `json:"job"`
+}
+
+// JobsService handles the job resources of projects.
+type JobsService struct {
+	client *Client
+}
+
+// List returns the jobs of a project.
+func (s *JobsService) List(ctx context.Context, projectID int) ([]Job, error) {
+	return s.list(ctx, projectPath(projectID)+"/jobs")
+}
+
+// ListAll returns the jobs of all projects of the user.
+func (s *JobsService) ListAll(ctx context.Context) ([]Job, error) {
+	return s.list(ctx, "/jobs")
+}
+
+func (s *JobsService) list(ctx context.Context, resource string) ([]Job, error) {
+	jobs := make([]Job, 0)
+	if err := s.client.call(ctx, "GET", s.client.APIPath(resource), nil, http.StatusOK, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Create starts a new job of the given kind ("build", "validate") for a project.
+func (s *JobsService) Create(ctx context.Context, projectID int, kind string) (*Job, error) {
+	param := &JobParam{
+		Job{
+			Kind:      kind,
+			ProjectId: projectID,
+		},
+	}
+	j := &Job{}
+	if err := s.client.call(ctx, "POST", s.client.APIPath(projectPath(projectID)+"/jobs"), param, http.StatusCreated, j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Get returns a job of a project.
+func (s *JobsService) Get(ctx context.Context, projectID, jobID int) (*Job, error) {
+	j := &Job{}
+	if err := s.client.call(ctx, "GET", s.client.APIPath(jobPath(projectID, jobID)), nil, http.StatusOK, j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Wait polls a job every interval until it is processed or ctx is done.
+// If poll is not nil, it is called with the job state after every attempt.
+func (s *JobsService) Wait(ctx context.Context, job *Job, interval time.Duration, poll func(*Job)) (*Job, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		j, err := s.Get(ctx, job.ProjectId, job.ID)
+		if err != nil {
+			return nil, err
+		}
+		if poll != nil {
+			poll(j)
+		}
+		if j.Processed() {
+			return j, nil
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package slyft
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Project struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Details   string    `json:"details"`
+	Settings  string    `json:"settings"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Path returns the resource path of the project in API version 1, e.g.
+// "/v1/projects/1". Use ResourcePath for the API version of a client.
+func (p *Project) Path() string {
+	return "/v1" + p.ResourcePath()
+}
+
+// ResourcePath returns the resource path of the project relative to the API
+// version, see Client.APIPath.
+func (p *Project) ResourcePath() string {
+	return projectPath(p.ID)
+}
+
+func projectPath(id int) string {
+	return fmt.Sprintf("/projects/%d", id)
+}
+
+type ProjectParam struct {
+	Project Project `json:"project"`
+}
+
+type SearchString struct {
+	SearchString string `json:"search_string"`
+}
+
+func createProjectParam(name, details, settings string) *ProjectParam {
+	return &ProjectParam{
+		Project{
+			Name:     name,
+			Details:  details,
+			Settings: settings,
+		},
+	}
+}
+
+// ProjectsService handles the project resources.
+type ProjectsService struct {
+	client *Client
+}
+
+// List returns all projects of the user.
+func (s *ProjectsService) List(ctx context.Context) ([]Project, error) {
+	projects := make([]Project, 0)
+	if err := s.client.call(ctx, "GET", s.client.APIPath("/projects"), nil, http.StatusOK, &projects); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+// Search returns the projects whose name contains portion. An empty portion
+// lists all projects.
+func (s *ProjectsService) Search(ctx context.Context, portion string) ([]Project, error) {
+	if strings.TrimSpace(portion) == "" {
+		return s.List(ctx)
+	}
+	projects := make([]Project, 0)
+	if err := s.client.call(ctx, "GET", s.client.APIPath("/projects/search"), &SearchString{portion}, http.StatusOK, &projects); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+// Get returns the project with the given id.
+func (s *ProjectsService) Get(ctx context.Context, id int) (*Project, error) {
+	p := &Project{}
+	if err := s.client.call(ctx, "GET", s.client.APIPath(projectPath(id)), nil, http.StatusOK, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Create creates a new project.
+func (s *ProjectsService) Create(ctx context.Context, name, details string) (*Project, error) {
+	p := &Project{}
+	if err := s.client.call(ctx, "POST", s.client.APIPath("/projects"), createProjectParam(name, details, ""), http.StatusCreated, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UpdateSettings replaces the settings (a JSON document) of a project.
+func (s *ProjectsService) UpdateSettings(ctx context.Context, id int, settings string) error {
+	return s.client.call(ctx, "PUT", s.client.APIPath(projectPath(id)), createProjectParam("", "", settings), http.StatusNoContent, nil)
+}
+
+// Delete removes the project with the given id.
+func (s *ProjectsService) Delete(ctx context.Context, id int) error {
+	return s.client.call(ctx, "DELETE", s.client.APIPath(projectPath(id)), nil, http.StatusNoContent, nil)
+}
@@ -0,0 +1,153 @@
+package slyft
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how requests are repeated after transient failures,
+// i.e. network errors, 429 Too Many Requests and 5xx responses.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts; 1 disables retries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry. It doubles with
+	// every further attempt, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Timeout limits the total time spent on a request including all
+	// retries and backoff. Zero means no limit.
+	Timeout time.Duration
+	// Methods lists the HTTP methods that may be retried.
+	Methods []string
+}
+
+// DefaultRetryPolicy retries idempotent requests up to three times in total.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+		Timeout:     60 * time.Second,
+		Methods:     []string{"GET", "PUT", "DELETE"},
+	}
+}
+
+func (p *RetryPolicy) allowsMethod(method string) bool {
+	for _, m := range p.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRetry reports whether the outcome of an attempt is transient.
+func (p *RetryPolicy) shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode == http.StatusNotImplemented:
+		return false
+	case resp.StatusCode >= 500:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before the next attempt. A Retry-After header of
+// the response takes precedence over the exponential backoff with jitter.
+func (p *RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return d
+		}
+	}
+	d := p.BaseDelay << uint(attempt-1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	// "equal jitter": at least half of the delay, plus a random share
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := t.Sub(time.Now())
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+type noRetryKey struct{}
+
+// WithoutRetry returns a context for requests that are sent only once,
+// whatever the retry policy of the client, e.g. because repeating them
+// after they succeeded would fail.
+func WithoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+// doWithRetry sends req, repeating it according to the retry policy of the
+// client. The request body is rewound between attempts.
+func (c *Client) doWithRetry(req *http.Request) (*http.Response, error) {
+	p := c.Retry
+	if p == nil || p.MaxAttempts <= 1 || !p.allowsMethod(req.Method) || req.Context().Value(noRetryKey{}) != nil {
+		return c.HTTPClient.Do(req)
+	}
+
+	ctx := req.Context()
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		resp, err := c.HTTPClient.Do(req)
+		if attempt >= p.MaxAttempts || !p.shouldRetry(ctx, resp, err) {
+			return resp, err
+		}
+
+		delay := p.backoff(attempt, resp)
+		if p.Timeout > 0 && time.Since(start)+delay > p.Timeout {
+			return resp, err
+		}
+		if err != nil {
+			log.Infof("%s %s failed (%s), retrying in %v", req.Method, req.URL, err, delay)
+		} else {
+			log.Infof("%s %s returned %s, retrying in %v", req.Method, req.URL, resp.Status, delay)
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package slyft
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func flakyServer(failures int, status int) (*httptest.Server, *int) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	return ts, &calls
+}
+
+func testClient(url string) *Client {
+	c := NewClient(url, nil, StaticAuth(testAuth))
+	c.Retry.BaseDelay = time.Millisecond
+	c.Retry.MaxDelay = 5 * time.Millisecond
+	return c
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	ts, calls := flakyServer(2, http.StatusBadGateway)
+	defer ts.Close()
+
+	if _, err := testClient(ts.URL).Projects.List(context.Background()); err != nil {
+		t.Fatalf("Must succeed after retries: %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", *calls)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	ts, calls := flakyServer(5, http.StatusServiceUnavailable)
+	defer ts.Close()
+
+	_, err := testClient(ts.URL).Projects.List(context.Background())
+	if e, ok := err.(*APIError); !ok || e.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status error for last attempt, got %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", *calls)
+	}
+}
+
+func TestNoRetryForPost(t *testing.T) {
+	ts, calls := flakyServer(1, http.StatusBadGateway)
+	defer ts.Close()
+
+	if _, err := testClient(ts.URL).Projects.Create(context.Background(), "foo", ""); err == nil {
+		t.Error("Must not retry POST")
+	}
+	if *calls != 1 {
+		t.Errorf("Expected 1 attempt, got %d", *calls)
+	}
+}
+
+func TestWithoutRetry(t *testing.T) {
+	ts, calls := flakyServer(1, http.StatusBadGateway)
+	defer ts.Close()
+
+	if _, err := testClient(ts.URL).Projects.List(WithoutRetry(context.Background())); err == nil {
+		t.Error("Must not retry without retries")
+	}
+	if *calls != 1 {
+		t.Errorf("Expected 1 attempt, got %d", *calls)
+	}
+}
+
+func TestNoRetryForClientErrors(t *testing.T) {
+	ts, calls := flakyServer(1, http.StatusNotFound)
+	defer ts.Close()
+
+	testClient(ts.URL).Projects.List(context.Background())
+	if *calls != 1 {
+		t.Errorf("Expected 1 attempt, got %d", *calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d, ok := parseRetryAfter("7"); !ok || d != 7*time.Second {
+		t.Errorf("Must parse seconds, got %v", d)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(date); !ok || d <= 0 || d > time.Minute {
+		t.Errorf("Must parse HTTP date, got %v", d)
+	}
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Error("Must reject invalid values")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := DefaultRetryPolicy()
+	for attempt := 1; attempt < 10; attempt++ {
+		d := p.backoff(attempt, nil)
+		if d < 0 || d > p.MaxDelay {
+			t.Errorf("Backoff %v out of range for attempt %d", d, attempt)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package slyft
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// bodies longer than this are truncated in traces
+const maxTraceBody = 2048
+
+// Tracer is an http.RoundTripper that writes a summary of every request
+// passed on to Transport to Out: method, URL, status, sizes, headers and
+// bodies with credentials redacted, and the time spent on DNS lookup,
+// connecting, the TLS handshake and waiting for the first response byte.
+type Tracer struct {
+	Transport http.RoundTripper
+	Out       io.Writer
+
+	mu sync.Mutex
+}
+
+// NewTracer returns a Tracer writing to out. If transport is nil,
+// http.DefaultTransport is used.
+func NewTracer(transport http.RoundTripper, out io.Writer) *Tracer {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Tracer{Transport: transport, Out: out}
+}
+
+// timings of a single request, see httptrace.ClientTrace
+type timings struct {
+	start, dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, firstByte time.Time
+	reused                                                                            bool
+}
+
+func (t *timings) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn:              func(i httptrace.GotConnInfo) { t.reused = i.Reused },
+		DNSStart:             func(httptrace.DNSStartInfo) { t.dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { t.connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { t.connectDone = time.Now() },
+		TLSHandshakeStart:    func() { t.tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.tlsDone = time.Now() },
+		GotFirstResponseByte: func() { t.firstByte = time.Now() },
+	}
+}
+
+func (t *timings) String() string {
+	d := func(from, to time.Time) string {
+		if from.IsZero() || to.IsZero() {
+			return "-"
+		}
+		return to.Sub(from).Round(time.Microsecond).String()
+	}
+	s := fmt.Sprintf("dns=%s connect=%s tls=%s ttfb=%s total=%s",
+		d(t.dnsStart, t.dnsDone), d(t.connectStart, t.connectDone), d(t.tlsStart, t.tlsDone),
+		d(t.start, t.firstByte), d(t.start, time.Now()))
+	if t.reused {
+		s += " (reused connection)"
+	}
+	return s
+}
+
+func (t *Tracer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = b
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+
+	tm := &timings{start: time.Now()}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), tm.clientTrace()))
+	resp, err := t.Transport.RoundTrip(req)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "--> %s %s (%d bytes)\n", req.Method, req.URL, len(reqBody))
+	writeTraceHeader(&b, req.Header)
+	writeTraceBody(&b, reqBody)
+	if err != nil {
+		fmt.Fprintf(&b, "<-- error: %s %s\n", err, tm)
+		t.write(b.Bytes())
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	if err != nil {
+		fmt.Fprintf(&b, "<-- %s, reading body failed: %s %s\n", resp.Status, err, tm)
+		t.write(b.Bytes())
+		return nil, err
+	}
+	fmt.Fprintf(&b, "<-- %s (%d bytes) %s\n", resp.Status, len(respBody), tm)
+	writeTraceHeader(&b, resp.Header)
+	writeTraceBody(&b, respBody)
+	t.write(b.Bytes())
+	return resp, nil
+}
+
+// write outputs the trace of one request in one piece, so that traces of
+// concurrent requests do not interleave.
+func (t *Tracer) write(b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Out.Write(b)
+}
+
+func writeTraceHeader(w io.Writer, h http.Header) {
+	h = redactHeader(h)
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "    %s: %s\n", k, strings.Join(h[k], ", "))
+	}
+}
+
+func writeTraceBody(w io.Writer, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	if !utf8.Valid(b) {
+		fmt.Fprintf(w, "    (%d bytes of binary data)\n", len(b))
+		return
+	}
+	fmt.Fprintf(w, "    %s\n", redactedBody(b))
+}
+
+// redactedBody returns b with credentials in JSON fields replaced, truncated
+// for logging.
+func redactedBody(b []byte) string {
+	s := string(redactBody(b))
+	if len(s) > maxTraceBody {
+		s = fmt.Sprintf("%s... (%d bytes)", s[:maxTraceBody], len(s))
+	}
+	return s
+}
@@ -0,0 +1,39 @@
+package slyft
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("access-token", "rotated-secret")
+		w.Write([]byte(`{"data": {"uid": "foo@bar.boo"}}`))
+	}))
+	defer ts.Close()
+
+	auth := Auth{AccessToken: "token-secret", Client: "client-secret", Uid: "uid-secret"}
+	var out bytes.Buffer
+	c := NewClient(ts.URL, &http.Client{Transport: NewTracer(nil, &out)}, StaticAuth(auth))
+	resp, err := c.Call(context.Background(), "POST", "/auth/password", map[string]string{"password": "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	trace := out.String()
+	for _, expected := range []string{"--> POST " + ts.URL + "/auth/password", "<-- 200 OK", "ttfb=", "Access-Token: " + Redacted} {
+		if !strings.Contains(trace, expected) {
+			t.Errorf("Trace must contain %q:\n%s", expected, trace)
+		}
+	}
+	for _, secret := range []string{auth.AccessToken, auth.Client, auth.Uid, "rotated-secret", "foo@bar.boo", `"secret"`} {
+		if strings.Contains(trace, secret) {
+			t.Errorf("Trace must not contain %s:\n%s", secret, trace)
+		}
+	}
+}
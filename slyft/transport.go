@@ -0,0 +1,83 @@
+package slyft
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TransportOptions configure the connection to the backend.
+type TransportOptions struct {
+	// CAFile is a PEM bundle of additional certificate authorities
+	// trusted besides the system roots.
+	CAFile string
+	// CertFile and KeyFile are the PEM encoded client certificate and
+	// key for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// Proxy is the URL of an HTTP(S) proxy. If empty, the proxy is taken
+	// from the HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables.
+	Proxy string
+	// Insecure disables the verification of server certificates.
+	Insecure bool
+}
+
+// NewTransport returns an http.Transport configured according to o. Like
+// http.DefaultTransport, it uses HTTP/2 where the server supports it.
+func NewTransport(o TransportOptions) (*http.Transport, error) {
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		// a custom TLSClientConfig disables HTTP/2 otherwise
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   10 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       &tls.Config{},
+	}
+
+	if o.Proxy != "" {
+		proxy, err := url.Parse(o.Proxy)
+		if err != nil || proxy.Scheme == "" || proxy.Host == "" {
+			return nil, errors.New("Invalid proxy URL: " + o.Proxy)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	if o.CAFile != "" {
+		pem, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificates found in CA bundle " + o.CAFile)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, errors.New("Client certificate and key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	t.TLSClientConfig.InsecureSkipVerify = o.Insecure
+	return t, nil
+}
@@ -0,0 +1,85 @@
+package slyft
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestTransportCAFile(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	list := func(o TransportOptions) error {
+		tr, err := NewTransport(o)
+		if err != nil {
+			t.Fatalf("Must create transport: %v", err)
+		}
+		c := NewClient(ts.URL, &http.Client{Transport: tr}, StaticAuth(testAuth))
+		c.Retry = nil
+		_, err = c.Projects.List(context.Background())
+		return err
+	}
+
+	if err := list(TransportOptions{}); err == nil {
+		t.Error("Must reject unknown CA")
+	}
+	if err := list(TransportOptions{Insecure: true}); err != nil {
+		t.Errorf("Must accept unknown CA in insecure mode: %v", err)
+	}
+
+	f, err := ioutil.TempFile("", "slyft-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	f.Close()
+
+	if err := list(TransportOptions{CAFile: f.Name()}); err != nil {
+		t.Errorf("Must accept server with CA from bundle: %v", err)
+	}
+}
+
+func TestTransportOptionErrors(t *testing.T) {
+	invalid := []TransportOptions{
+		{Proxy: "not a url"},
+		{CAFile: "/does/not/exist.pem"},
+		{CertFile: "cert.pem"},
+		{KeyFile: "key.pem"},
+	}
+	for _, o := range invalid {
+		if _, err := NewTransport(o); err == nil {
+			t.Errorf("Must reject %+v", o)
+		}
+	}
+	if _, err := NewTransport(TransportOptions{Proxy: "http://proxy.example.com:3128"}); err != nil {
+		t.Errorf("Must accept proxy URL: %v", err)
+	}
+}
+
+func TestTransportHTTP2(t *testing.T) {
+	proto := ""
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Proto
+		w.Write([]byte(`[]`))
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	tr, err := NewTransport(TransportOptions{Insecure: true})
+	if err != nil {
+		t.Fatalf("Must create transport: %v", err)
+	}
+	c := NewClient(ts.URL, &http.Client{Transport: tr}, StaticAuth(testAuth))
+	if _, err := c.Projects.List(context.Background()); err != nil || proto != "HTTP/2.0" {
+		t.Errorf("Expected HTTP/2, got %q (%v)", proto, err)
+	}
+}
@@ -0,0 +1,27 @@
+package slyft
+
+import (
+	"context"
+	"net/http"
+)
+
+// User is the account a session belongs to.
+type User struct {
+	ID       int    `json:"id"`
+	Email    string `json:"email"`
+	Uid      string `json:"uid"`
+	Provider string `json:"provider"`
+}
+
+// ValidateToken checks the credentials of the AuthSource with the backend
+// and returns the account they belong to. For an invalid session, the
+// error satisfies IsUnauthorized.
+func (c *Client) ValidateToken(ctx context.Context) (*User, error) {
+	var v struct {
+		Data User `json:"data"`
+	}
+	if err := c.call(ctx, "GET", "/auth/validate_token", nil, http.StatusOK, &v); err != nil {
+		return nil, err
+	}
+	return &v.Data, nil
+}
@@ -0,0 +1,77 @@
+package slyft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// API versions implemented by this package. Resource paths start with the
+// version, e.g. "/v1/projects", see Client.APIPath.
+const (
+	MinAPIVersion = 1
+	MaxAPIVersion = 1
+)
+
+// VersionMismatchError is returned by NegotiateAPIVersion if the backend
+// and this package have no API version in common.
+type VersionMismatchError struct {
+	ServerMin, ServerMax int
+}
+
+func (e *VersionMismatchError) Error() string {
+	if e.ServerMin > MaxAPIVersion {
+		return fmt.Sprintf("The backend requires API version %d to %d, but this client supports only %d to %d. Please update the client",
+			e.ServerMin, e.ServerMax, MinAPIVersion, MaxAPIVersion)
+	}
+	return fmt.Sprintf("The backend supports only API version %d to %d, but this client requires %d to %d. Please use an older client",
+		e.ServerMin, e.ServerMax, MinAPIVersion, MaxAPIVersion)
+}
+
+// NegotiateAPIVersion returns the API version to use with a backend that
+// supports versions min to max and recommends current: current if this
+// package supports it, else the highest version both support.
+func NegotiateAPIVersion(min, max, current int) (int, error) {
+	lo, hi := min, max
+	if lo < MinAPIVersion {
+		lo = MinAPIVersion
+	}
+	if hi > MaxAPIVersion {
+		hi = MaxAPIVersion
+	}
+	if lo > hi {
+		return 0, &VersionMismatchError{ServerMin: min, ServerMax: max}
+	}
+	if current >= lo && current <= hi {
+		return current, nil
+	}
+	return hi, nil
+}
+
+// ServerVersion describes the backend, see Client.ServerVersion.
+type ServerVersion struct {
+	Version    string `json:"version"`
+	APIVersion struct {
+		Min int `json:"min"`
+		Max int `json:"max"`
+	} `json:"api_version"`
+}
+
+// ServerVersion returns the version of the backend from GET /version,
+// which needs no credentials.
+func (c *Client) ServerVersion(ctx context.Context) (*ServerVersion, error) {
+	resp, err := c.CallNoAuth(ctx, "GET", "/version", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := CheckResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	var v ServerVersion
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
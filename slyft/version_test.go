@@ -0,0 +1,82 @@
+package slyft
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	for _, tc := range []struct {
+		min, max, current int
+		want              int
+		mismatch          string
+	}{
+		{MinAPIVersion, MaxAPIVersion, MaxAPIVersion, MaxAPIVersion, ""},
+		{MinAPIVersion, MaxAPIVersion + 2, MaxAPIVersion + 1, MaxAPIVersion, ""},
+		{MinAPIVersion - 1, MaxAPIVersion, MinAPIVersion - 1, MaxAPIVersion, ""},
+		{MaxAPIVersion + 1, MaxAPIVersion + 2, MaxAPIVersion + 1, 0, "update the client"},
+		{MinAPIVersion - 2, MinAPIVersion - 1, MinAPIVersion - 1, 0, "older client"},
+	} {
+		v, err := NegotiateAPIVersion(tc.min, tc.max, tc.current)
+		if tc.mismatch == "" {
+			if err != nil || v != tc.want {
+				t.Errorf("%d-%d (%d): expected %d, got %d %v", tc.min, tc.max, tc.current, tc.want, v, err)
+			}
+			continue
+		}
+		if _, ok := err.(*VersionMismatchError); !ok || !strings.Contains(err.Error(), tc.mismatch) {
+			t.Errorf("%d-%d: expected mismatch %q, got %d %v", tc.min, tc.max, tc.mismatch, v, err)
+		}
+	}
+}
+
+func TestAPIPath(t *testing.T) {
+	c := NewClient("http://localhost:3000", nil, nil)
+	if p := c.APIPath("/projects"); p != "/v1/projects" {
+		t.Errorf("Unexpected path %s", p)
+	}
+	c.APIVersion = 2
+	if p := c.APIPath(projectPath(3)); p != "/v2/projects/3" {
+		t.Errorf("Unexpected path %s", p)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" || r.Header.Get("access-token") != "" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"version": "2.1.0", "api_version": {"min": 1, "max": 2}}`)
+	}))
+	defer ts.Close()
+
+	v, err := NewClient(ts.URL, nil, nil).ServerVersion(context.Background())
+	if err != nil || v.Version != "2.1.0" || v.APIVersion.Min != 1 || v.APIVersion.Max != 2 {
+		t.Errorf("Unexpected version %+v %v", v, err)
+	}
+}
+
+func TestResourcePaths(t *testing.T) {
+	c := NewClient("http://localhost:3000", nil, nil)
+	c.APIVersion = 2
+	p := &Project{ID: 1}
+	a := &Asset{ID: 2, ProjectId: 1}
+	j := &Job{ID: 3, ProjectId: 1}
+	for _, tc := range []struct{ got, want string }{
+		{p.Path(), "/v1/projects/1"},
+		{a.Path(), "/v1/projects/1/assets/2"},
+		{j.Path(), "/v1/projects/1/jobs/3"},
+		{c.APIPath(p.ResourcePath()), "/v2/projects/1"},
+		{c.APIPath(a.ResourcePath()), "/v2/projects/1/assets/2"},
+		{c.APIPath(j.ResourcePath()), "/v2/projects/1/jobs/3"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("Expected %s, got %s", tc.want, tc.got)
+		}
+	}
+}
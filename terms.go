@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+)
+
+// AcceptedTerms records which version of the Terms and Conditions the user
+// of a profile accepted. The text itself is kept in termsFile(Hash), so
+// that later versions can be compared with it.
+type AcceptedTerms struct {
+	Url        string    `json:"url"`
+	Hash       string    `json:"hash"`
+	AcceptedAt time.Time `json:"accepted_at"`
+}
+
+// termsDocument is a version of the Terms and Conditions.
+type termsDocument struct {
+	Url  string
+	Text string
+}
+
+// Hash returns the SHA-256 of the text.
+func (t *termsDocument) Hash() string {
+	sum := sha256.Sum256([]byte(t.Text))
+	return hex.EncodeToString(sum[:])
+}
+
+func fetchTerms() (*termsDocument, error) {
+	uri, err := termsUri()
+	if err != nil {
+		return nil, err
+	}
+	text, err := getTermsDocument(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &termsDocument{Url: uri, Text: text}, nil
+}
+
+// termsFile is where the text of accepted terms is kept.
+func termsFile(hash string) string {
+	return configPath("terms", hash+".txt")
+}
+
+// acceptedTerms returns the terms accepted for the active profile, or nil if
+// none are known.
+func acceptedTerms() *AcceptedTerms {
+	sr, _ := readConfig()
+	return sr.AcceptedTerms[sr.profileName()]
+}
+
+// recordTermsAcceptance remembers that the user of the active profile
+// accepted t.
+func recordTermsAcceptance(t *termsDocument) error {
+	hash := t.Hash()
+	if err := writeFileAtomic(termsFile(hash), []byte(t.Text)); err != nil {
+		return err
+	}
+	return updateConfig(func(sr *SlyftRC) bool {
+		if sr.AcceptedTerms == nil {
+			sr.AcceptedTerms = map[string]*AcceptedTerms{}
+		}
+		sr.AcceptedTerms[sr.profileName()] = &AcceptedTerms{Url: t.Url, Hash: hash, AcceptedAt: time.Now().UTC()}
+		return true
+	})
+}
+
+// warnIfTermsChanged tells the user if the current terms differ from the
+// ones accepted.
+func warnIfTermsChanged() {
+	if accepted := termsChanged(); accepted != nil {
+		fmt.Printf("\nThe Terms and Conditions have changed since you accepted them on %s.\n", accepted.AcceptedAt.Local().Format("2006-01-02"))
+		fmt.Println("Please review them with `slyft user terms --diff`.")
+	}
+}
+
+// termsChanged returns the accepted terms if the current ones differ from
+// them, else nil. Like `slyft user terms`, it compares the text, so that
+// terms changed under the same URL are noticed.
+func termsChanged() *AcceptedTerms {
+	accepted := acceptedTerms()
+	if accepted == nil {
+		return nil
+	}
+	current, err := fetchTerms()
+	if err != nil {
+		Log.Debugf("Unable to check the Terms and Conditions: %s", err)
+		return nil
+	}
+	if current.Hash() == accepted.Hash {
+		return nil
+	}
+	return accepted
+}
+
+// diffLines compares a and b line by line, based on their longest common
+// subsequence. Lines are prefixed with "  " if unchanged, "- " if only in a
+// and "+ " if only in b.
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff = append(diff, "  "+a[i])
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+	return diff
+}
+
+// changedLines returns the changed lines of diff with up to context
+// unchanged lines around them. Omitted lines are replaced by "...".
+func changedLines(diff []string, context int) []string {
+	keep := make([]bool, len(diff))
+	for i, line := range diff {
+		if strings.HasPrefix(line, "  ") {
+			continue
+		}
+		for k := i - context; k <= i+context; k++ {
+			if k >= 0 && k < len(diff) {
+				keep[k] = true
+			}
+		}
+	}
+	var out []string
+	for i, line := range diff {
+		switch {
+		case keep[i]:
+			out = append(out, line)
+		case i == 0 || keep[i-1]:
+			out = append(out, "...")
+		}
+	}
+	return out
+}
+
+// termsStatus is shown by `slyft user terms` with --output json.
+type termsStatus struct {
+	Url      string         `json:"url"`
+	Hash     string         `json:"hash"`
+	Accepted *AcceptedTerms `json:"accepted,omitempty"`
+	Changed  bool           `json:"changed"`
+	Text     string         `json:"text,omitempty"`
+}
+
+func showTerms(cmd *cli.Cmd) {
+	cmd.Spec = "[--diff]"
+	diff := cmd.BoolOpt("diff d", false, "Show the changes since the terms you accepted")
+
+	cmd.Action = func() {
+		current, err := fetchTerms()
+		if err != nil {
+			ReportError("Getting the Terms and Conditions", err)
+			cli.Exit(1)
+		}
+		accepted := acceptedTerms()
+		changed := accepted != nil && accepted.Hash != current.Hash()
+
+		switch {
+		case outputJSON():
+			st := termsStatus{Url: current.Url, Hash: current.Hash(), Accepted: accepted, Changed: changed}
+			if !*diff {
+				st.Text = current.Text
+			}
+			printJSON(st)
+		case *diff:
+			if accepted == nil {
+				fmt.Println("There is no record of the terms you accepted, nothing to compare with.")
+				cli.Exit(1)
+			}
+			if !changed {
+				fmt.Printf("The Terms and Conditions have not changed since you accepted them on %s.\n", accepted.AcceptedAt.Local().Format("2006-01-02"))
+				break
+			}
+			b, err := ioutil.ReadFile(termsFile(accepted.Hash))
+			if err != nil {
+				ReportError("Reading the accepted terms", err)
+				cli.Exit(1)
+			}
+			fmt.Printf("--- accepted %s (%s)\n+++ current %s\n", accepted.Url, accepted.AcceptedAt.Local().Format("2006-01-02"), current.Url)
+			for _, line := range changedLines(diffLines(strings.Split(string(b), "\n"), strings.Split(current.Text, "\n")), 2) {
+				fmt.Println(line)
+			}
+		default:
+			displayTermsAndConditions(current)
+			switch {
+			case accepted == nil:
+				fmt.Println("There is no record of you accepting these terms.")
+			case changed:
+				fmt.Printf("These terms differ from the ones you accepted on %s, see `slyft user terms --diff`.\n", accepted.AcceptedAt.Local().Format("2006-01-02"))
+			default:
+				fmt.Printf("You accepted these terms on %s.\n", accepted.AcceptedAt.Local().Format("2006-01-02"))
+			}
+		}
+	}
+}
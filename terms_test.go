@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	a := strings.Split("intro\nold rule\nsame\nend", "\n")
+	b := strings.Split("intro\nnew rule\nsame\nadded\nend", "\n")
+	expected := []string{"  intro", "- old rule", "+ new rule", "  same", "+ added", "  end"}
+	if diff := diffLines(a, b); !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected %q, got %q", expected, diff)
+	}
+
+	diff := []string{"  1", "  2", "  3", "  4", "- 5", "+ 6", "  7", "  8", "  9"}
+	expected = []string{"...", "  3", "  4", "- 5", "+ 6", "  7", "  8", "..."}
+	if lines := changedLines(diff, 2); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+}
+
+func TestRecordTermsAcceptance(t *testing.T) {
+	defer withTempHome(t)()
+
+	if acceptedTerms() != nil {
+		t.Error("Must not know accepted terms initially")
+	}
+	terms := &termsDocument{Url: "https://example.com/terms/1", Text: "Be nice.\n"}
+	if err := recordTermsAcceptance(terms); err != nil {
+		t.Fatalf("Must record acceptance: %v", err)
+	}
+	accepted := acceptedTerms()
+	if accepted == nil || accepted.Url != terms.Url || accepted.Hash != terms.Hash() || accepted.AcceptedAt.IsZero() {
+		t.Fatalf("Unexpected accepted terms %+v", accepted)
+	}
+	if b, err := ioutil.ReadFile(termsFile(accepted.Hash)); err != nil || string(b) != terms.Text {
+		t.Errorf("Must keep text of accepted terms, got %q (%v)", b, err)
+	}
+}
+
+func TestTermsChanged(t *testing.T) {
+	defer withTempHome(t)()
+
+	text := "Be nice.\n"
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/terms":
+			fmt.Fprintf(w, `{"url": "%s/terms.txt"}`, ts.URL)
+		case "/terms.txt":
+			fmt.Fprint(w, text)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	os.Setenv("SLYFTBACKEND", ts.URL)
+	defer os.Unsetenv("SLYFTBACKEND")
+	apiClient = nil
+	defer func() { apiClient = nil }()
+
+	if termsChanged() != nil {
+		t.Error("Must not report changes without accepted terms")
+	}
+	current, err := fetchTerms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordTermsAcceptance(current)
+	if termsChanged() != nil {
+		t.Error("Must not report unchanged terms")
+	}
+
+	// terms changed under the same URL
+	text = "Be very nice.\n"
+	if accepted := termsChanged(); accepted == nil || accepted.Url != current.Url {
+		t.Errorf("Must report terms changed in place, got %+v", accepted)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// stepError tells which step of processing a file failed.
+type stepError struct {
+	step string
+	err  error
+}
+
+func (e *stepError) Error() string {
+	return e.step + ": " + e.err.Error()
+}
+
+// reportStepError is ReportError for errors that may carry a step.
+func reportStepError(err error) {
+	if e, ok := err.(*stepError); ok {
+		ReportError(e.step, e.err)
+		return
+	}
+	ReportError("Processing file", err)
+}
+
+// transferResult is the outcome of uploading or downloading one file.
+type transferResult struct {
+	File     string
+	Err      error
+	Duration time.Duration
+}
+
+// transferFiles calls fn for every file, with at most parallel calls running
+// at the same time. Results are returned in the order of files. Files not
+// started before an interrupt are reported as cancelled.
+func transferFiles(files []string, parallel int, fn func(file string) error) []transferResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+	results := make([]transferResult, len(files))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < parallel && w < len(files); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i].File = files[i]
+				if err := requestContext().Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				start := time.Now()
+				results[i].Err = fn(files[i])
+				results[i].Duration = time.Since(start)
+			}
+		}()
+	}
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// transferStatus is the JSON output of displayTransfers.
+type transferStatus struct {
+	File       string `json:"file"`
+	Ok         bool   `json:"ok"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// displayTransfers prints a summary table of results and returns the
+// number of failed files.
+func displayTransfers(results []transferResult) int {
+	failed := 0
+	statuses := []transferStatus{}
+	data := [][]string{
+		[]string{"File", "Result", "Duration", "Details"},
+	}
+	for _, r := range results {
+		st := transferStatus{File: r.File, Ok: r.Err == nil, DurationMs: int64(r.Duration / time.Millisecond)}
+		result, details := "ok", ""
+		if r.Err != nil {
+			failed++
+			result, details = "failed", r.Err.Error()
+			st.Error = details
+		}
+		statuses = append(statuses, st)
+		data = append(data, []string{r.File, result, r.Duration.Round(time.Millisecond).String(), details})
+	}
+
+	if outputJSON() {
+		printJSON(statuses)
+		return failed
+	}
+	fmt.Fprintf(os.Stdout, "%s%s",
+		markdownHeading("Summary", 1),
+		markdownTable(&data))
+	reportFailures(failed, len(results))
+	return failed
+}
+
+// reportFailures tells how many of total files failed, if any.
+func reportFailures(failed, total int) {
+	if failed > 0 {
+		fmt.Printf("%d of %d files failed.\n", failed, total)
+	}
+}
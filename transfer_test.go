@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransferFiles(t *testing.T) {
+	files := []string{"a.json", "b.json", "c.json", "d.json", "e.json"}
+	var running, maxRunning int32
+	results := transferFiles(files, 2, func(file string) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if file == "c.json" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	if maxRunning != 2 {
+		t.Errorf("Expected 2 concurrent transfers, got %d", maxRunning)
+	}
+	if len(results) != len(files) {
+		t.Fatalf("Expected %d results, got %d", len(files), len(results))
+	}
+	for i, r := range results {
+		if r.File != files[i] || (r.Err != nil) != (r.File == "c.json") {
+			t.Errorf("Unexpected result %d: %+v", i, r)
+		}
+	}
+	if failed := displayTransfers(results); failed != 1 {
+		t.Errorf("Expected 1 failure, got %d", failed)
+	}
+	defer func() { outputFormat = "text" }()
+	outputFormat = "json"
+	if failed := displayTransfers(results); failed != 1 {
+		t.Errorf("Expected 1 failure as JSON, got %d", failed)
+	}
+}
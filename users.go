@@ -2,10 +2,10 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/jawher/mow.cli"
+	"github.com/thingforward/slyft-cli/slyft"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -22,11 +23,7 @@ type SlyftAuth struct {
 	AccessToken string `json:"access_token"`
 	Client      string `json:"client"`
 	Uid         string `json:"uid"`
-}
-
-type SlyftAuthResult struct {
-	Success bool
-	Errors  []string
+	Expiry      int64  `json:"expiry,omitempty"`
 }
 
 func (sa SlyftAuth) String() string {
@@ -42,7 +39,48 @@ func (sa SlyftAuth) GoodForLogin() bool {
 }
 
 type SlyftRC struct {
+	// Credentials and settings of the default profile
 	Auth SlyftAuth
+	Settings
+	// Profile used unless --profile/SLYFT_PROFILE is given (empty: default)
+	CurrentProfile string `json:",omitempty"`
+	// Named profiles, see profiles.go
+	Profiles map[string]*Profile `json:",omitempty"`
+	// Time of the last successful API call per profile (seconds since the epoch)
+	LastUsed map[string]int64 `json:",omitempty"`
+	// Terms and Conditions accepted per profile, see terms.go
+	AcceptedTerms map[string]*AcceptedTerms `json:",omitempty"`
+}
+
+// Settings can be given for the default profile and for named profiles,
+// see config.go for their keys and validation.
+type Settings struct {
+	// Backend URL (empty: production backend)
+	Backend string `json:",omitempty"`
+	// Output format, "text" or "json" (empty: text)
+	Output string `json:",omitempty"`
+	// Project used if there is no .slyftproject
+	Project string `json:",omitempty"`
+	// Skip the check for a new version on startup
+	NoUpdateCheck bool `json:",omitempty"`
+	// Where `slyft self-update` downloads releases from
+	UpdateURL string `json:",omitempty"`
+	// Where credentials are kept: plaintext, file or helper, see credentials.go
+	CredentialStore string `json:",omitempty"`
+	// Command of the external credential helper
+	CredentialHelper string `json:",omitempty"`
+	// Total number of attempts for idempotent requests (0: default)
+	RetryAttempts int `json:",omitempty"`
+	// Max. seconds spent on retrying a request (nil: default, 0: no limit)
+	RetryTimeout *int `json:",omitempty"`
+	// Max. seconds for a single request (nil: default, 0: no limit)
+	Timeout *int `json:",omitempty"`
+	// TLS and proxy settings for the backend connection
+	CAFile     string `json:",omitempty"`
+	ClientCert string `json:",omitempty"`
+	ClientKey  string `json:",omitempty"`
+	Proxy      string `json:",omitempty"`
+	Insecure   bool   `json:",omitempty"`
 }
 
 func (sr SlyftRC) String() string {
@@ -60,6 +98,19 @@ type Credentials struct {
 	TermsAcceptance      TermsAcceptance `json:"terms"`
 }
 
+// PasswordChange is sent to change the password of the logged in user.
+type PasswordChange struct {
+	CurrentPassword      string `json:"current_password"`
+	Password             string `json:"password"`
+	PasswordConfirmation string `json:"password_confirmation"`
+}
+
+// EmailParam identifies the account to send a password reset,
+// confirmation or unlock email to.
+type EmailParam struct {
+	Email string `json:"email"`
+}
+
 type Terms struct {
 	Url       string `json:"url"`
 	StartedAt string `json:"started_at"`
@@ -70,31 +121,97 @@ type TermsAcceptance struct {
 	Timestamp string `json:"timestamp"`
 }
 
-func readSecret(ask string) string {
-	pwd_from_env := os.Getenv("SLYFT_USER_REGISTRATION_PWD")
+// passwordEnv supplies the password instead of asking for it. As it gives
+// the same value every time, a rejected one must not be asked for again.
+const passwordEnv = "SLYFT_USER_REGISTRATION_PWD"
+
+func readSecret(ask string) (string, error) {
+	pwd_from_env := os.Getenv(passwordEnv)
 	if len(pwd_from_env) == 0 {
 		fmt.Print(ask)
 		byteSecret, err := terminal.ReadPassword(int(syscall.Stdin))
 		fmt.Println("")
 		if err != nil {
-			Log.Critical("Reading secrect failed: " + err.Error())
+			return "", errors.New("Reading the password failed: " + err.Error())
 		}
-		return string(byteSecret)
+		return string(byteSecret), nil
 	} else {
 		fmt.Print(ask)
 		fmt.Print(" <<SUPLIED BY ENV VARIABLE>>")
 		fmt.Println("")
-		return pwd_from_env
+		return pwd_from_env, nil
+	}
+}
+
+// isInteractive reports whether we can ask the user, i.e. stdin is a
+// terminal.
+func isInteractive() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// credentialOptions are the command line options of login and register.
+type credentialOptions struct {
+	email         *string
+	passwordStdin *bool
+	passwordFile  *string
+	acceptTerms   *bool
+}
+
+func emailOpt(cmd *cli.Cmd) *string {
+	return cmd.String(cli.StringOpt{
+		Name:   "email e",
+		Desc:   "Email address of your account",
+		EnvVar: "SLYFT_EMAIL",
+	})
+}
+
+func credentialFlags(cmd *cli.Cmd, register bool) *credentialOptions {
+	o := &credentialOptions{
+		email:         emailOpt(cmd),
+		passwordStdin: cmd.BoolOpt("password-stdin", false, "Read the password from stdin"),
+		passwordFile:  cmd.StringOpt("password-file", "", "Read the password from the given file"),
+		acceptTerms:   new(bool),
+	}
+	cmd.Spec = "[--email] [--password-stdin | --password-file]"
+	if register {
+		o.acceptTerms = cmd.BoolOpt("accept-terms", false, "Accept the Terms and Conditions without displaying them")
+		cmd.Spec += " [--accept-terms]"
+	}
+	return o
+}
+
+// password returns the password given by --password-stdin, --password-file,
+// SLYFT_PASSWORD or SLYFT_USER_REGISTRATION_PWD, or "" if there is none.
+func (o *credentialOptions) password() (string, error) {
+	switch {
+	case *o.passwordStdin:
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	case *o.passwordFile != "":
+		b, err := ioutil.ReadFile(*o.passwordFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0]), nil
+	case os.Getenv("SLYFT_PASSWORD") != "":
+		return os.Getenv("SLYFT_PASSWORD"), nil
 	}
+	return os.Getenv("SLYFT_USER_REGISTRATION_PWD"), nil
 }
 
 func termsUri() (string, error) {
 	// get T&C JSON from endpoint to get the URL to the latest terms document
 	resp, err := DoNoAuth("/terms", "GET", nil)
-	defer resp.Body.Close()
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
+	if err := slyft.CheckResponse(resp, http.StatusOK); err != nil {
+		return "", err
+	}
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return "", err
@@ -106,17 +223,16 @@ func termsUri() (string, error) {
 	return t.Url, nil
 }
 
-func getTerms() (string, error) {
+func getTermsDocument(termsUri string) (string, error) {
 	// get the terms content as string from the referenced terms document
-	termsUri, err := termsUri()
+	response, err := httpClient().Get(termsUri)
 	if err != nil {
 		return "", err
 	}
-	response, err := http.Get(termsUri)
-	if err != nil {
+	defer response.Body.Close()
+	if err := slyft.CheckResponse(response, http.StatusOK); err != nil {
 		return "", err
 	}
-	defer response.Body.Close()
 	responseData, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		return "", err
@@ -125,15 +241,10 @@ func getTerms() (string, error) {
 	return responseString, nil
 }
 
-func displayTermsAndConditions() error {
+func displayTermsAndConditions(terms *termsDocument) {
 	// display terms file contents
-	terms, err := getTerms()
-	if err != nil {
-		fmt.Println(err)
-		return err
-	}
 	fmt.Print("\n-------------------------------------------------\n")
-	lines := strings.Split(terms, "\n")
+	lines := strings.Split(terms.Text, "\n")
 	term_height := TerminalHeight() - 2
 	reader := bufio.NewReader(os.Stdin)
 	for idx, line := range lines {
@@ -147,18 +258,14 @@ func displayTermsAndConditions() error {
 	}
 
 	fmt.Print("-------------------------------------------------\n")
-	return nil
 }
 
-func acceptTermsAndConditions() (bool, error) {
+func acceptTermsAndConditions(terms *termsDocument) (bool, error) {
 	/*
 		- ask user for acceptance
 		- return boolean true/false based on user input
 	*/
-	err := displayTermsAndConditions()
-	if err != nil {
-		return false, nil
-	}
+	displayTermsAndConditions(terms)
 	accept := askForConfirmation("Do you accept the Terms and Conditions?")
 	if accept == false {
 		return false, nil
@@ -166,35 +273,111 @@ func acceptTermsAndConditions() (bool, error) {
 	return accept, nil
 }
 
-func readCredentials(confirm bool) (string, string, string) {
-	reader := bufio.NewReader(os.Stdin)
+// readCredentials takes email and password from the command line options
+// or the environment. Missing ones are asked for if stdin is a terminal.
+func readCredentials(o *credentialOptions, confirm bool) (string, string, string, error) {
+	email := strings.TrimSpace(*o.email)
+	password, err := o.password()
+	if err != nil {
+		return "", "", "", err
+	}
+	if (email == "" || password == "") && !isInteractive() {
+		return "", "", "", errors.New("stdin is not a terminal, please give --email (or SLYFT_EMAIL) and --password-file, --password-stdin (or SLYFT_PASSWORD)")
+	}
 
-	var email, password string
-	proceed := false
-	for proceed == false {
+	if email != "" && !validateEmail(email) {
+		return "", "", "", errors.New("Not a valid email address: " + email)
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for email == "" {
 		fmt.Print("Enter Email: ")
-		email, _ = reader.ReadString('\n')
-		proceed = validateEmail(strings.TrimSpace(email))
-		if proceed == false {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", "", "", err
+		}
+		email = strings.TrimSpace(line)
+		if !validateEmail(email) {
 			fmt.Println("Not a valid email address. Please try again.")
+			email = ""
 		}
 	}
 
-	proceed = false
-	for proceed == false {
-		password = readSecret("Enter Password (min. 6 characters): ")
-		proceed = validatePassword(strings.TrimSpace(password))
-		if proceed == false {
+	if password != "" {
+		if !validatePassword(password) {
+			return "", "", "", errors.New("Not a valid password, it must have at least 6 characters")
+		}
+		// given non-interactively, there is nothing to confirm
+		if !confirm {
+			return email, password, "", nil
+		}
+		if score, hints := passwordStrength(password, email); score < minPasswordScore {
+			return "", "", "", errors.New("The password is too weak: " + strings.Join(hints, "; "))
+		}
+		return email, password, password, nil
+	}
+	if confirm {
+		password, err := readNewPassword("Enter Password (min. 6 characters): ", "Please confirm Password: ", email)
+		if err != nil {
+			return "", "", "", err
+		}
+		return email, password, password, nil
+	}
+	for password == "" {
+		secret, err := readSecret("Enter Password (min. 6 characters): ")
+		if err != nil {
+			return "", "", "", err
+		}
+		password = strings.TrimSpace(secret)
+		if !validatePassword(password) {
+			if os.Getenv(passwordEnv) != "" {
+				return "", "", "", errors.New("Not a valid password in " + passwordEnv + ", it must have at least 6 characters")
+			}
 			fmt.Println("Not a valid password. Please try again.")
+			password = ""
 		}
 	}
+	return email, password, "", nil
+}
 
-	if !confirm {
-		return strings.TrimSpace(email), strings.TrimSpace(password), ""
+// readNewPassword asks for a new password of the account email until it is
+// strong enough and confirmed correctly. A password from passwordEnv is
+// checked once, and reading errors end the loop as well.
+func readNewPassword(ask, askConfirmation, email string) (string, error) {
+	fromEnv := os.Getenv(passwordEnv) != ""
+	for {
+		password, err := readSecret(ask)
+		if err != nil {
+			return "", err
+		}
+		password = strings.TrimSpace(password)
+		if !validatePassword(password) {
+			if fromEnv {
+				return "", errors.New("Not a valid password in " + passwordEnv + ", it must have at least 6 characters")
+			}
+			fmt.Println("Not a valid password. Please try again.")
+			continue
+		}
+		if score, hints := passwordStrength(password, email); score < minPasswordScore {
+			if fromEnv {
+				return "", errors.New("The password in " + passwordEnv + " is too weak: " + strings.Join(hints, "; "))
+			}
+			fmt.Println("This password is too weak:")
+			for _, hint := range hints {
+				fmt.Printf("* %s\n", hint)
+			}
+			fmt.Println("Please try again.")
+			continue
+		}
+		confirmation, err := readSecret(askConfirmation)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(confirmation) != password {
+			fmt.Println("Passwords do not match. Please try again.")
+			continue
+		}
+		return password, nil
 	}
-
-	passwordConfirmation := readSecret("Please confirm Password: ")
-	return strings.TrimSpace(email), strings.TrimSpace(password), strings.TrimSpace(passwordConfirmation)
 }
 
 func validatePassword(s string) bool {
@@ -208,121 +391,132 @@ func validateEmail(s string) bool {
 	return re.FindStringIndex(s) != nil
 }
 
-func getCredentials(confirm bool) *Credentials {
-	email, password, confirmation := readCredentials(confirm)
+func getCredentials(o *credentialOptions, confirm bool) (*Credentials, error) {
+	email, password, confirmation, err := readCredentials(o, confirm)
+	if err != nil {
+		return nil, err
+	}
 	return &Credentials{
 		Email:                email,
 		Password:             password,
 		PasswordConfirmation: confirmation,
-	}
+	}, nil
 }
 
 func extractAuthFromHeader(hdr *http.Header) SlyftAuth {
+	a := slyft.AuthFromHeader(*hdr)
 	return SlyftAuth{
-		AccessToken: hdr.Get("access-token"),
-		Client:      hdr.Get("client"),
-		Uid:         hdr.Get("uid"),
+		AccessToken: a.AccessToken,
+		Client:      a.Client,
+		Uid:         a.Uid,
+		Expiry:      a.Expiry,
 	}
 }
 
-func authenticateUser(endpoint string, register bool) error {
-	url := ServerURL(endpoint)
-	creds := getCredentials(register)
+// authenticateUser registers or logs in and returns the email address used.
+func authenticateUser(endpoint string, register bool, o *credentialOptions) (string, error) {
+	creds, err := getCredentials(o, register)
+	if err != nil {
+		return "", err
+	}
 	// if the user wants to register, show T&C to the user, and ask for acceptance
+	var terms *termsDocument
 	if register {
-		fmt.Print("\nFor a successful registration, we kindly ask you to read and accept our\n")
-		fmt.Print("Terms and Conditions. Please press [ENTER] to view and accept. >")
-		reader := bufio.NewReader(os.Stdin)
-		_, err := reader.ReadString('\n')
-
-		accept, err := acceptTermsAndConditions()
-		if !accept {
-			return errors.New(fmt.Sprintf("You need to accept the terms first. %v\n", err))
+		accept := *o.acceptTerms
+		terms, err = fetchTerms()
+		if accept {
+			if err == nil {
+				fmt.Printf("Accepting the Terms and Conditions at %s\n", terms.Url)
+			}
+		} else {
+			if !isInteractive() {
+				return creds.Email, errors.New("stdin is not a terminal, please accept the Terms and Conditions with --accept-terms")
+			}
+			if err != nil {
+				return creds.Email, fmt.Errorf("Unable to get the Terms and Conditions: %s", err)
+			}
+			fmt.Print("\nFor a successful registration, we kindly ask you to read and accept our\n")
+			fmt.Print("Terms and Conditions. Please press [ENTER] to view and accept. >")
+			reader := bufio.NewReader(os.Stdin)
+			_, err := reader.ReadString('\n')
+
+			accept, err = acceptTermsAndConditions(terms)
+			if !accept {
+				return creds.Email, errors.New(fmt.Sprintf("You need to accept the terms first. %v\n", err))
+			}
 		}
 		creds.TermsAcceptance.Accepted = accept
 		creds.TermsAcceptance.Timestamp = time.Now().UTC().Format("2006-01-02T15:04:05-0700")
 	}
-	b := new(bytes.Buffer)
-	json.NewEncoder(b).Encode(creds)
-
-	Log.Debugf("url=%#v", url)
-
-	resp, err := http.Post(url, "application/json; charset=utf-8", b)
-
-	Log.Debugf("err=%#v", err)
-	Log.Debugf("resp=%#v", resp)
-
+	resp, err := DoNoAuth(endpoint, "POST", creds)
 	if err != nil {
-		return err
+		return creds.Email, err
 	}
 	defer resp.Body.Close()
 
-	// Verify if the resp was ok
-	if resp.StatusCode == http.StatusCreated || resp.StatusCode == http.StatusOK {
-		slyftAuth := extractAuthFromHeader(&resp.Header)
-		return writeAuthToConfig(&slyftAuth)
+	if err := slyft.CheckResponse(resp, http.StatusCreated, http.StatusOK); err != nil {
+		return creds.Email, err
 	}
-
-	// handle the error
-	body, err := ioutil.ReadAll(resp.Body)
-	if err == nil {
-		if register {
-			fmt.Print("\nWe're sorry, but your registration failed due to the following errors:\n")
-			var f interface{}
-			err := json.Unmarshal(body, &f)
-			if err == nil {
-				m := f.(map[string]interface{})
-				e := (m["errors"]).(map[string]interface{})
-				fm := (e["full_messages"]).([]interface{})
-				for _, msg := range fm {
-					fmt.Printf("* %s\n", msg)
-				}
-
-			}
-		} else {
-			fmt.Print("\nWe're sorry, but your login failed due to the following errors:\n")
-			var sar SlyftAuthResult
-			err := json.Unmarshal(body, &sar)
-			if err == nil {
-				for _, msg := range sar.Errors {
-					fmt.Printf("* %s\n", msg)
-				}
-			} else {
-				// Unable to parse it, log as-is
-				Log.Critical(string(body))
-			}
+	slyftAuth := extractAuthFromHeader(&resp.Header)
+	if err := writeAuthToConfig(&slyftAuth); err != nil {
+		return creds.Email, err
+	}
+	if terms != nil {
+		if err := recordTermsAcceptance(terms); err != nil {
+			Log.Errorf("Unable to record the accepted Terms and Conditions: %s", err)
 		}
-		return errors.New(fmt.Sprintf("Server returned failure: %v\nBye", resp.Status))
-	} else {
-		Log.Critical("Error reading/parsing API output.")
 	}
+	return creds.Email, nil
+}
 
-	return errors.New(fmt.Sprintf("Reading server resonse failed: %v\n", err))
+// reportAuthError lists the reasons the server gave for a failed
+// registration or login.
+func reportAuthError(what string, err error) {
+	e, ok := err.(*slyft.APIError)
+	if !ok || len(e.Messages) == 0 {
+		ReportError(what, err)
+		return
+	}
+	fmt.Printf("\nWe're sorry, but your %s failed due to the following errors:\n", strings.ToLower(what))
+	for _, msg := range e.Messages {
+		fmt.Printf("* %s\n", msg)
+	}
+	if e.RequestID != "" {
+		Log.Debugf("request id=%s", e.RequestID)
+	}
 }
 
-func RegisterUser() {
+func RegisterUser(o *credentialOptions) {
 	fmt.Println("\nThank you for your interest in Slyft! Please provide us your email address and")
 	fmt.Println("a password (min. 6 characters). Please make sure you have access to the email account given")
 	fmt.Println("as we will send you a confirmation email to this address.")
 	fmt.Println()
-	err := authenticateUser("/auth", true)
+	_, err := authenticateUser("/auth", true, o)
 	if err != nil {
+		reportAuthError("Registration", err)
 		fmt.Println("We're very sorry, but your registration failed.")
+		cli.Exit(1)
 	} else {
 		fmt.Println("\nRegistration successful. We've sent you a confirmation email to the email address")
 		fmt.Println("you given for this registration process. Please have a look at your inbox for")
 		fmt.Println("a new message from `info@slyft.io` and follow the instructions presented there")
-		fmt.Println("to activate your account.")
+		fmt.Println("to activate your account. If it does not arrive, use `slyft user confirm --resend`.")
 		fmt.Println()
 	}
 }
 
-func LogUserIn() {
-	err := authenticateUser("/auth/sign_in", false)
+func LogUserIn(o *credentialOptions) {
+	email, err := authenticateUser("/auth/sign_in", false, o)
 	if err != nil {
+		reportAuthError("Login", err)
 		fmt.Println("Sorry, login failed")
+		if a := accountEmailFor(err); a != nil {
+			a.offerResend(email)
+		}
+		cli.Exit(1)
 	} else {
 		fmt.Println("Login successful, have fun! For documentation, please have a look at www.slyft.io/docs")
+		warnIfTermsChanged()
 	}
 }
 
@@ -330,36 +524,22 @@ func makeDeleteCall(endpoint string) error {
 	resp, err := Do(endpoint, "DELETE", nil)
 	deactivateLogin()
 
-	Log.Debugf("err=%#v", err)
-	Log.Debugf("resp=%#v", resp)
-
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	// Verify if the resp was ok
-	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusOK {
-		slyftAuth := extractAuthFromHeader(&resp.Header)
-		return writeAuthToConfig(&slyftAuth)
-	}
-
-	// handle the error
-	body, err := ioutil.ReadAll(resp.Body)
-	Log.Debugf("err=%#v", err)
-	Log.Debugf("body=%#v", body)
-	if err == nil {
-		Log.Critical(string(body)) // TODO -- parse and print it beautifully. Extract errors/full_messages/etc.
-		return errors.New(fmt.Sprintf("Server returned failure: %v\nBye", resp.Status))
+	if err := slyft.CheckResponse(resp, http.StatusNoContent, http.StatusOK); err != nil {
+		return err
 	}
-
-	return errors.New(fmt.Sprintf("Reading server resonse failed: %v\n", err))
+	slyftAuth := extractAuthFromHeader(&resp.Header)
+	return writeAuthToConfig(&slyftAuth)
 }
 
 func LogUserOut() {
 	err := makeDeleteCall("/auth/sign_out")
 	if err != nil {
-		Log.Error("Sorry, logout failed.")
+		ReportError("Logout", err)
 	} else {
 		fmt.Println("Bye for now. Looking forward to seeing you soon...")
 	}
@@ -384,7 +564,7 @@ func DeleteUser() {
 	if confirm {
 		err := makeDeleteCall("/auth")
 		if err != nil {
-			Log.Error("Sorry, deletion failed")
+			ReportError("Deleting the account", err)
 		} else {
 			fmt.Println("Deleted the account. We are sorry to see you go. Come back soon...")
 		}
@@ -393,11 +573,304 @@ func DeleteUser() {
 	}
 }
 
+func ChangePassword() {
+	auth, err := readAuthFromConfig()
+	if err != nil || !auth.GoodForLogin() {
+		fmt.Println("You do not seem to be logged in. Please do a `slyft user login`")
+		cli.Exit(1)
+	}
+	if !isInteractive() {
+		fmt.Println("stdin is not a terminal, cannot ask for the passwords")
+		cli.Exit(1)
+	}
+	// it would be used as both the current and the new password
+	if os.Getenv(passwordEnv) != "" {
+		fmt.Printf("%s cannot be used to change the password, please unset it\n", passwordEnv)
+		cli.Exit(1)
+	}
+
+	current, err := readSecret("Enter current Password: ")
+	if err != nil {
+		ReportError("Password change", err)
+		cli.Exit(1)
+	}
+	current = strings.TrimSpace(current)
+	password, err := readNewPassword("Enter new Password (min. 6 characters): ", "Please confirm new Password: ", auth.Uid)
+	if err != nil {
+		ReportError("Password change", err)
+		cli.Exit(1)
+	}
+
+	// a repeated request would fail, as the current password has changed
+	resp, err := API().Call(slyft.WithoutRetry(requestContext()), "PUT", "/auth/password", &PasswordChange{
+		CurrentPassword:      current,
+		Password:             password,
+		PasswordConfirmation: password,
+	})
+	if err == nil {
+		defer resp.Body.Close()
+		err = slyft.CheckResponse(resp, http.StatusOK)
+	}
+	if err != nil {
+		reportAuthError("Password change", err)
+		fmt.Println("Password left unchanged.")
+		cli.Exit(1)
+	}
+	fmt.Println("Your password has been changed.")
+}
+
+// askEmail returns email, or asks for it if it is empty. It exits if there
+// is no valid email address.
+func askEmail(email string) string {
+	e := strings.TrimSpace(email)
+	if e == "" {
+		if !isInteractive() {
+			fmt.Println("stdin is not a terminal, please give --email (or SLYFT_EMAIL)")
+			cli.Exit(1)
+		}
+		fmt.Print("Enter Email: ")
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		e = strings.TrimSpace(line)
+	}
+	if !validateEmail(e) {
+		fmt.Println("Not a valid email address: " + e)
+		cli.Exit(1)
+	}
+	return e
+}
+
+func ResetPassword(email *string) {
+	e := askEmail(*email)
+	resp, err := DoNoAuth("/auth/password", "POST", &EmailParam{Email: e})
+	if err == nil {
+		defer resp.Body.Close()
+		err = slyft.CheckResponse(resp, http.StatusOK)
+	}
+	if err != nil {
+		reportAuthError("Password reset", err)
+		cli.Exit(1)
+	}
+	fmt.Printf("We've sent an email to %s. Please follow the instructions presented there\n", e)
+	fmt.Println("to set a new password.")
+}
+
+// accountEmail is an email the backend sends on request, to confirm or to
+// unlock an account.
+type accountEmail struct {
+	name     string
+	resource string
+	// the `slyft user` command to request it
+	command string
+	purpose string
+}
+
+var (
+	confirmationEmail = &accountEmail{name: "confirmation email", resource: "/auth/confirmation", command: "confirm", purpose: "activate your account"}
+	unlockEmail       = &accountEmail{name: "unlock email", resource: "/auth/unlock", command: "unlock", purpose: "unlock your account"}
+)
+
+// accountEmailFor returns the email that helps if a login failed with err
+// because the account is not confirmed yet or locked, and nil otherwise.
+func accountEmailFor(err error) *accountEmail {
+	e, ok := err.(*slyft.APIError)
+	if !ok || e.StatusCode != http.StatusUnauthorized {
+		return nil
+	}
+	for _, msg := range e.Messages {
+		msg = strings.ToLower(msg)
+		switch {
+		case strings.Contains(msg, "locked"):
+			return unlockEmail
+		case strings.Contains(msg, "confirm"):
+			return confirmationEmail
+		}
+	}
+	return nil
+}
+
+func (a *accountEmail) resend(email string) error {
+	resp, err := DoNoAuth(a.resource, "POST", &EmailParam{Email: email})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return slyft.CheckResponse(resp, http.StatusOK)
+}
+
+func (a *accountEmail) sent(email string) {
+	fmt.Printf("We've sent the %s to %s. Please follow the instructions presented there\n", a.name, email)
+	fmt.Printf("to %s.\n", a.purpose)
+}
+
+// offerResend asks whether to send the email again, after a login failed.
+func (a *accountEmail) offerResend(email string) {
+	if email == "" || !isInteractive() {
+		fmt.Printf("To get a new %s, use `slyft user %s --resend`\n", a.name, a.command)
+		return
+	}
+	if !askForConfirmation(fmt.Sprintf("Shall we send you the %s again?", a.name)) {
+		return
+	}
+	if err := a.resend(email); err != nil {
+		reportAuthError("Request for a new "+a.name, err)
+		return
+	}
+	a.sent(email)
+}
+
+func (a *accountEmail) route(cmd *cli.Cmd) {
+	cmd.Spec = "[--resend] [--email]"
+	resend := cmd.BoolOpt("resend", false, "Send the "+a.name+" again")
+	email := emailOpt(cmd)
+
+	cmd.Action = func() {
+		if !*resend {
+			fmt.Printf("Please follow the instructions of the %s we've sent you to %s.\n", a.name, a.purpose)
+			fmt.Printf("If it did not arrive, use `slyft user %s --resend`.\n", a.command)
+			return
+		}
+		e := askEmail(*email)
+		if err := a.resend(e); err != nil {
+			reportAuthError("Request for a new "+a.name, err)
+			cli.Exit(1)
+		}
+		a.sent(e)
+	}
+}
+
+func RegisterPasswordRoutes(password *cli.Cmd) {
+	password.Command("change", "Change your password", func(cmd *cli.Cmd) { cmd.Action = ChangePassword })
+	password.Command("reset", "Get an email to reset a forgotten password", func(cmd *cli.Cmd) {
+		email := emailOpt(cmd)
+		cmd.Spec = "[--email]"
+		cmd.Action = func() { ResetPassword(email) }
+	})
+}
+
+// sessionStatus is shown by `slyft user whoami`.
+type sessionStatus struct {
+	Valid    bool       `json:"valid"`
+	Uid      string     `json:"uid"`
+	Email    string     `json:"email,omitempty"`
+	Profile  string     `json:"profile"`
+	Backend  string     `json:"backend"`
+	Expiry   *time.Time `json:"expiry,omitempty"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+func displaySession(st *sessionStatus) {
+	if outputJSON() {
+		printJSON(st)
+		return
+	}
+
+	valid := "yes"
+	if !st.Valid {
+		valid = "no (" + st.Error + ")"
+	}
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return "unknown"
+		}
+		return fmt.Sprintf("%s (%s)", t.Local().Format(time.RFC1123), humanizeSince(*t))
+	}
+	data := [][]string{
+		[]string{"Key", "Value"},
+		[]string{"Valid", valid},
+		[]string{"User", st.Uid},
+		[]string{"Profile", st.Profile},
+		[]string{"Backend", st.Backend},
+		[]string{"TokenExpiry", formatTime(st.Expiry)},
+		[]string{"LastSuccessfulCall", formatTime(st.LastUsed)},
+	}
+	fmt.Fprintf(os.Stdout, "%s%s",
+		markdownHeading("Session", 1),
+		markdownTable(&data))
+}
+
+// humanizeSince describes t relative to now, e.g. "3h ago" or "in 13d".
+func humanizeSince(t time.Time) string {
+	d := time.Since(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	var s string
+	switch {
+	case d < time.Minute:
+		s = fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		s = fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		s = fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		s = fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
+
+// ShowSession validates the stored credentials with the backend. It exits
+// non-zero if there is no valid session.
+func ShowSession() {
+	sr, _ := readConfig()
+	st := &sessionStatus{Profile: sr.profileName(), Backend: backendURL()}
+
+	auth, err := readAuthFromConfig()
+	if err != nil || !auth.GoodForLogin() {
+		st.Error = "not logged in"
+		displaySession(st)
+		cli.Exit(1)
+	}
+	st.Uid = auth.Uid
+
+	u, err := API().ValidateToken(requestContext())
+	switch {
+	case slyft.IsUnauthorized(err):
+		st.Error = "session expired or revoked, please do a `slyft user login`"
+	case err != nil:
+		st.Error = "unable to reach the backend: " + err.Error()
+	default:
+		st.Valid = true
+		st.Email = u.Email
+	}
+
+	// the backend may have rotated the token meanwhile
+	if auth, err := readAuthFromConfig(); err == nil && auth.Expiry > 0 {
+		t := time.Unix(auth.Expiry, 0)
+		st.Expiry = &t
+	}
+	sr, _ = readConfig()
+	if at := sr.LastUsed[st.Profile]; at > 0 {
+		t := time.Unix(at, 0)
+		st.LastUsed = &t
+	}
+
+	displaySession(st)
+	if !st.Valid {
+		cli.Exit(1)
+	}
+}
+
 func RegisterUserRoutes(user *cli.Cmd) {
 	SetupLogger()
 
-	user.Command("register r", "Register yourself", func(cmd *cli.Cmd) { cmd.Action = RegisterUser })
-	user.Command("login l", "Login with your credentials", func(cmd *cli.Cmd) { cmd.Action = LogUserIn })
+	user.Command("register r", "Register yourself", func(cmd *cli.Cmd) {
+		o := credentialFlags(cmd, true)
+		cmd.Action = func() { RegisterUser(o) }
+	})
+	user.Command("login l", "Login with your credentials", func(cmd *cli.Cmd) {
+		o := credentialFlags(cmd, false)
+		cmd.Action = func() { LogUserIn(o) }
+	})
+	user.Command("whoami status", "Check your session with the backend", func(cmd *cli.Cmd) { cmd.Action = ShowSession })
+	user.Command("confirm", "Confirm your account", confirmationEmail.route)
+	user.Command("unlock", "Unlock your account after too many failed logins", unlockEmail.route)
+	user.Command("terms", "Show the Terms and Conditions", showTerms)
+	user.Command("password", "Change or reset your password", RegisterPasswordRoutes)
 	user.Command("logout", "Log out from your session", func(cmd *cli.Cmd) { cmd.Action = LogUserOut })
 	user.Command("delete", "Delete your account", func(cmd *cli.Cmd) { cmd.Action = DeleteUser })
 }
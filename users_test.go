@@ -1,7 +1,14 @@
 package main
 
 import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
 	"testing"
+
+	"github.com/thingforward/slyft-cli/slyft"
 )
 
 func TestValidatePassword(t *testing.T) {
@@ -34,3 +41,84 @@ func TestValidateEmail(t *testing.T) {
 		t.Errorf("Must reject invalid email %s", invalid2)
 	}
 }
+
+func TestReadCredentialsNonInteractive(t *testing.T) {
+	email, stdin, file := "", false, ""
+	o := &credentialOptions{email: &email, passwordStdin: &stdin, passwordFile: &file, acceptTerms: new(bool)}
+
+	// tests do not run on a terminal, so there is no prompting
+	if _, _, _, err := readCredentials(o, false); err == nil {
+		t.Error("Must fail without email and password")
+	}
+
+	f, err := ioutil.TempFile("", "slyft-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("glacier-Mango-47\nignored\n")
+	f.Close()
+
+	email, file = "foo@bar.boo", f.Name()
+	e, p, c, err := readCredentials(o, true)
+	if err != nil || e != email || p != "glacier-Mango-47" || c != p {
+		t.Errorf("Unexpected credentials %s/%s/%s (%v)", e, p, c, err)
+	}
+
+	// registration rejects weak passwords, login does not
+	ioutil.WriteFile(f.Name(), []byte("secret12\n"), 0600)
+	if _, _, _, err := readCredentials(o, true); err == nil {
+		t.Error("Must reject weak password at registration")
+	}
+	if _, p, _, err := readCredentials(o, false); err != nil || p != "secret12" {
+		t.Errorf("Must accept existing password at login, got %s (%v)", p, err)
+	}
+
+	email = "foobar.boo"
+	if _, _, _, err := readCredentials(o, false); err == nil {
+		t.Error("Must reject invalid email")
+	}
+}
+
+func TestReadNewPassword(t *testing.T) {
+	// a rejected password from the environment is not asked for again
+	os.Setenv(passwordEnv, "secret12")
+	if _, err := readNewPassword("", "", "foo@bar.boo"); err == nil || !strings.Contains(err.Error(), passwordEnv) {
+		t.Errorf("Must reject weak password from %s, got %v", passwordEnv, err)
+	}
+	os.Setenv(passwordEnv, "short")
+	if _, err := readNewPassword("", "", "foo@bar.boo"); err == nil {
+		t.Errorf("Must reject short password from %s", passwordEnv)
+	}
+	os.Setenv(passwordEnv, "glacier-Mango-47")
+	if p, err := readNewPassword("", "", "foo@bar.boo"); err != nil || p != "glacier-Mango-47" {
+		t.Errorf("Must accept strong password from %s, got %s (%v)", passwordEnv, p, err)
+	}
+	os.Unsetenv(passwordEnv)
+
+	// tests do not run on a terminal, so reading fails instead of looping
+	if _, err := readNewPassword("", "", "foo@bar.boo"); err == nil {
+		t.Error("Must fail if the password cannot be read")
+	}
+}
+
+func TestAccountEmailFor(t *testing.T) {
+	unauthorized := func(msg string) error {
+		return &slyft.APIError{StatusCode: http.StatusUnauthorized, Messages: []string{msg}}
+	}
+	tests := []struct {
+		err      error
+		expected *accountEmail
+	}{
+		{unauthorized("A confirmation email was sent to your account at 'foo@bar.boo'. You must follow the instructions in the email before your account can be activated"), confirmationEmail},
+		{unauthorized("Your account has been locked due to an excessive number of unsuccessful sign in attempts."), unlockEmail},
+		{unauthorized("Invalid login credentials. Please try again."), nil},
+		{&slyft.APIError{StatusCode: http.StatusUnprocessableEntity, Messages: []string{"Email was already confirmed"}}, nil},
+		{errors.New("connection refused"), nil},
+	}
+	for _, tt := range tests {
+		if a := accountEmailFor(tt.err); a != tt.expected {
+			t.Errorf("%v: expected %v, got %v", tt.err, tt.expected, a)
+		}
+	}
+}
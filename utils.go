@@ -14,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/siddontang/go/log"
+	"github.com/thingforward/slyft-cli/slyft"
 )
 
 func askForConfirmation(s string) bool {
@@ -47,7 +48,32 @@ func portableGetUsersHome() string {
 	return home
 }
 
+// defaultConfigFile returns the config file: SLYFT_CONFIG, or config.json
+// in configDir.
 func defaultConfigFile() string {
+	if file := os.Getenv("SLYFT_CONFIG"); file != "" {
+		return file
+	}
+	return filepath.Join(configDir(), "config.json")
+}
+
+// configPath returns the path of a file next to the config file.
+func configPath(elem ...string) string {
+	return filepath.Join(append([]string{filepath.Dir(defaultConfigFile())}, elem...)...)
+}
+
+// configDir returns the slyft directory below $XDG_CONFIG_HOME, which
+// defaults to ~/.config.
+func configDir() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" || !filepath.IsAbs(base) {
+		base = filepath.Join(portableGetUsersHome(), ".config")
+	}
+	return filepath.Join(base, "slyft")
+}
+
+// legacyConfigFile is where older versions of slyft kept the config.
+func legacyConfigFile() string {
 	return filepath.FromSlash(portableGetUsersHome() + "/.slyftrc")
 }
 
@@ -84,33 +110,92 @@ func readConfig() (*SlyftRC, error) {
 	return &sr, nil
 }
 
-func writeAuthToConfig(sa *SlyftAuth) error {
-	sr, _ := readConfig()
-	// note -- we are ignoring the error here.
-
-	sr.Auth = *sa
-	newConfig, err := json.MarshalIndent(sr, "", "	")
+// updateConfig applies fn to the current config and writes the result back,
+// holding the config lock meanwhile. If fn returns false, nothing is written.
+// A missing config counts as empty, but a config that cannot be read or
+// parsed is left alone, so that a typo does not wipe all profiles.
+func updateConfig(fn func(sr *SlyftRC) bool) error {
+	unlock, err := lockConfig()
 	if err != nil {
-		Log.Error("Failure to update config file: " + defaultConfigFile())
+		Log.Error("Failure to lock config file: " + defaultConfigFile())
 		return err
 	}
+	defer unlock()
 
-	err = ioutil.WriteFile(defaultConfigFile(), newConfig, 0640)
-	if err != nil {
-		Log.Error("Failure to write config file: " + defaultConfigFile())
-		return err
+	sr, err := readConfig()
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to update %s: %s", defaultConfigFile(), err)
+	}
+
+	if !fn(sr) {
+		return nil
+	}
+	return writeConfig(sr)
+}
+
+func writeAuthToConfig(sa *SlyftAuth) error {
+	if replaying() {
+		// replayed credentials are redacted, keep the real ones
+		Log.Debug("Not storing credentials while replaying")
+		return nil
 	}
-	return nil
+	return updateAuth(func(stored *SlyftAuth) bool {
+		*stored = *sa
+		return true
+	})
+}
+
+// updateAuth applies fn to the credentials of the active profile and stores
+// the result, holding the config lock meanwhile. If fn returns false,
+// nothing is stored.
+func updateAuth(fn func(sa *SlyftAuth) bool) error {
+	var err error
+	if uerr := updateConfig(func(sr *SlyftRC) bool {
+		profile := sr.profileName()
+		var store CredentialStore
+		if store, err = sr.credentialStore(profile); err != nil {
+			return false
+		}
+		sa, gerr := store.Get(profile)
+		if gerr != nil {
+			// note -- like a missing config, unreadable credentials are replaced
+			Log.Debugf("Reading credentials failed: %s", gerr)
+			sa = &SlyftAuth{}
+		}
+		if !fn(sa) {
+			return false
+		}
+		if !sa.GoodForLogin() {
+			err = store.Erase(profile)
+		} else {
+			err = store.Store(profile, sa)
+		}
+		// other stores keep nothing in the config file
+		_, plaintext := store.(plaintextStore)
+		return err == nil && plaintext
+	}); uerr != nil {
+		return uerr
+	}
+	return err
 }
 
 func readAuthFromConfig() (*SlyftAuth, error) {
 	sr, err := readConfig()
+	store, serr := sr.credentialStore(sr.profileName())
+	if serr != nil {
+		return nil, serr
+	}
+	var sa *SlyftAuth
+	if _, plaintext := store.(plaintextStore); err == nil || !plaintext {
+		// other stores do not need a readable config
+		sa, err = store.Get(sr.profileName())
+	}
 	if err != nil {
 		Log.Error("You don't seem to be logged in. Failed to read your config: " + err.Error())
 		return nil, err
 	}
 
-	return &sr.Auth, nil
+	return sa, nil
 }
 
 func deactivateLogin() {
@@ -164,9 +249,16 @@ func TerminalHeight() int {
 
 // looks in current directory for a file `.slyftproject`,
 // reads the first line and returns it (as a replacename
-// for --name parameter whereever a project name is required)
+// for --name parameter whereever a project name is required).
+// Without .slyftproject, the project setting of the config is used.
 func ReadProjectLock() (string, error) {
 	f, err := os.Open(".slyftproject")
+	if os.IsNotExist(err) {
+		if p := currentSettings().Project; p != "" {
+			Log.Debugf("Operating on project=%s (from config)", p)
+			return p, nil
+		}
+	}
 	if err != nil {
 		return "", err
 	}
@@ -182,9 +274,24 @@ func ReadProjectLock() (string, error) {
 }
 
 func ReportError(context string, err error) {
+	if interrupted() {
+		fmt.Printf("%s: interrupted.\n", context)
+		return
+	}
 	fmt.Printf("%s: failed.\n", context)
-	if err != nil {
+	if err == nil {
+		return
+	}
+	if e, ok := err.(*slyft.APIError); ok && len(e.Messages) > 1 {
+		fmt.Println("Details:")
+		for _, msg := range e.Messages {
+			fmt.Printf("* %s\n", msg)
+		}
+	} else {
 		fmt.Printf("Details: %s\n", err.Error())
-		Log.Debugf("%s - failed - %s\n", context, err)
 	}
+	if e, ok := err.(*slyft.APIError); ok {
+		Log.Debugf("%s %s returned %s (request id=%s)", e.Method, e.Endpoint, e.Status, e.RequestID)
+	}
+	Log.Debugf("%s - failed - %s\n", context, err)
 }